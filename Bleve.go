@@ -1,14 +1,16 @@
 package apsa
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"path"
 	"strings"
 	"time"
 
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
 
 	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/analysis/analyzer/simple"
@@ -19,6 +21,107 @@ type Bleve struct {
 	Backend Backend
 }
 
+// indexVersion has to be incremented whenever the index mapping or the
+// document type change, so that existing indices get rebuilt.
+const indexVersion = "8"
+
+// document is the representation of a recipe in the index.
+type document struct {
+	Id     Id             `json:"id"`
+	Title  string         `json:"title"`
+	Source string         `json:"source"`
+	Tags   []string       `json:"tags"`
+	Steps  []documentStep `json:"steps"`
+
+	// Normalised names of all ingredients, without amounts and notes
+	Ingredients []string `json:"ingredients"`
+
+	// Allergens and diets derived from the ingredients, in lower case
+	Allergens []string `json:"allergens"`
+	Diets     []string `json:"diet"`
+
+	// Times in minutes, nil if unknown
+	PreparationTime *float64 `json:"preparation_time"`
+	CookingTime     *float64 `json:"cooking_time"`
+	BakingTime      *float64 `json:"baking_time"`
+	WaitingTime     *float64 `json:"waiting_time"`
+	TotalTime       *float64 `json:"total_time"`
+
+	// Range of portions, nil if unknown
+	PortionsMin *float64 `json:"portions_min"`
+	PortionsMax *float64 `json:"portions_max"`
+
+	// Temperatures in degrees Celsius, nil if unknown
+	FanTemp              *float64 `json:"fan_temp"`
+	TopAndBottomHeatTemp *float64 `json:"top_and_bottom_heat_temp"`
+}
+
+type documentStep struct {
+	Title        string   `json:"title"`
+	Ingredients  []string `json:"ingredients"`
+	Instructions string   `json:"instructions"`
+}
+
+func minutes(d Duration) *float64 {
+	if d == 0 {
+		return nil
+	}
+	result := d.Minutes()
+	return &result
+}
+
+func celsius(t *Temperature) *float64 {
+	if t == nil {
+		return nil
+	}
+	result := t.Degrees
+	if t.Unit == "°F" {
+		result = (result - 32) * 5 / 9
+	}
+	return &result
+}
+
+func newDocument(recipe ModernistRecipe) document {
+	doc := document{
+		Id:     recipe.Id,
+		Title:  recipe.Title,
+		Source: recipe.Source,
+		Tags:   recipe.Tags,
+
+		PreparationTime: minutes(recipe.PreparationTime),
+		CookingTime:     minutes(recipe.CookingTime),
+		BakingTime:      minutes(recipe.BakingTime),
+		WaitingTime:     minutes(recipe.WaitingTime),
+		TotalTime:       minutes(recipe.Duration()),
+
+		FanTemp:              celsius(recipe.FanTemp),
+		TopAndBottomHeatTemp: celsius(recipe.TopAndBottomHeatTemp),
+	}
+	if portions, _ := parseAmount(recipe.Portions); !portions.IsZero() {
+		doc.PortionsMin = &portions.Min
+		doc.PortionsMax = &portions.Max
+	}
+	for _, step := range recipe.Steps {
+		s := documentStep{Instructions: step.Instructions}
+		if step.Title != nil {
+			s.Title = *step.Title
+		}
+		for _, ingredient := range step.Ingredients {
+			s.Ingredients = append(s.Ingredients, ingredient.String())
+		}
+		doc.Steps = append(doc.Steps, s)
+	}
+	for _, item := range mergeIngredients([]ModernistRecipe{recipe}) {
+		doc.Ingredients = append(doc.Ingredients, ingredientKey(item.Name))
+	}
+	classification := Classify(recipe)
+	for _, allergen := range classification.Allergens {
+		doc.Allergens = append(doc.Allergens, strings.ToLower(allergen))
+	}
+	doc.Diets = classification.Diets
+	return doc
+}
+
 func touch(file string) error {
 	now := time.Now()
 	return os.Chtimes(file, now, now)
@@ -29,11 +132,25 @@ func (b Bleve) BuildIndex() error {
 	// TODO handle multiple fields, i.e. the main text, @source, @type, tags, etc.
 	newIndex := false
 
-	// Try to open an existing index or create a new one if none exists.
+	// Try to open an existing index or create a new one if none exists or
+	// it is outdated.
+	versionFile := Config.ApsaDirectory + "index_version"
+	version, _ := ioutil.ReadFile(versionFile)
 	index, err := openIndex()
+	if err == nil && strings.TrimSpace(string(version)) != indexVersion {
+		log.Println("The index is outdated. Rebuilding it.")
+		index.Close()
+		err = os.RemoveAll(Config.ApsaDirectory + "bleve")
+		if err != nil {
+			return err
+		}
+		index, err = openIndex()
+	}
 	if err != nil {
 		index = createIndex()
 		newIndex = true
+		err = ioutil.WriteFile(versionFile, []byte(indexVersion+"\n"), 0644)
+		TryLogError(err)
 	}
 	defer index.Close()
 
@@ -54,35 +171,44 @@ func (b Bleve) BuildIndex() error {
 		return err
 	}
 
+	collisions, err := checkCollisions(nil)
+	TryLogError(err)
+	for _, collision := range collisions {
+		LogError(collision)
+	}
+
 	batch := index.NewBatch()
+	seen := make(map[Id]bool)
 	for _, file := range files {
-		// Check whether the recipe is newer than the index.
-		modTime, err := getModTime(Config.KnowledgeDirectory + file.Name())
-		if err != nil {
-			LogError(err)
+		id, ok := idFromFileName(file.Name())
+		if !ok || seen[id] {
 			continue
 		}
+		seen[id] = true
 
-		filename := file.Name()
-		extension := path.Ext(filename)
-		var id string
-		if extension == ".md" {
-			id = strings.TrimSuffix(filename, ".md")
-		} else if extension == ".yaml" {
-			id = strings.TrimSuffix(filename, ".yaml")
-		} else {
+		// Check whether the recipe is newer than the index.  Any of its
+		// files may have changed, not just the first one listed.
+		modTime, err := recipeModTime(id)
+		if err != nil {
+			LogError(err)
 			continue
 		}
-
 		if modTime < indexUpdateTime && !newIndex {
 			continue
 		}
 
 		// Load and parse the recipe content
-		recipe, err := b.Backend.ReadRecipe(Id(id))
-		TryLogError(err)
+		recipe, err := b.Backend.ReadRecipe(id)
+		if errors.Is(err, ErrIdCollision) {
+			// Do not keep showing an outdated version of the recipe.
+			batch.Delete(string(id))
+			continue
+		} else if err != nil {
+			LogError(err)
+			continue
+		}
 
-		err = batch.Index(id, recipe)
+		err = batch.Index(string(id), newDocument(recipe))
 		TryLogError(err)
 	}
 	err = index.Batch(batch)
@@ -94,6 +220,16 @@ func (b Bleve) BuildIndex() error {
 	return nil
 }
 
+// IndexRecipe adds a single recipe to the index or updates it.
+func IndexRecipe(recipe ModernistRecipe) error {
+	index, err := openIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	return index.Index(string(recipe.Id), newDocument(recipe))
+}
+
 func RemoveFromIndex(id Id) error {
 	index, err := openIndex()
 	if err != nil {
@@ -118,15 +254,36 @@ func createIndex() bleve.Index {
 	typeMapping := bleve.NewTextFieldMapping()
 	typeMapping.Analyzer = keyword.Name
 
+	numericMapping := bleve.NewNumericFieldMapping()
+
 	stepsMapping := bleve.NewDocumentMapping()
 	stepsMapping.AddFieldMappingsAt("instructions", textMapping)
 
 	recipeMapping := bleve.NewDocumentMapping()
 	recipeMapping.AddFieldMappingsAt("id", simpleMapping)
 	recipeMapping.AddFieldMappingsAt("content", textMapping)
-	recipeMapping.AddFieldMappingsAt("source", simpleMapping)
-	recipeMapping.AddFieldMappingsAt("tags", simpleMapping)
+	recipeMapping.AddFieldMappingsAt(ingredientsField, textMapping)
+	recipeMapping.AddFieldMappingsAt(allergensField, typeMapping)
+	recipeMapping.AddFieldMappingsAt(dietField, typeMapping)
+	// Tags and sources are additionally indexed verbatim for faceting and
+	// exact filtering.
+	tagMapping := bleve.NewTextFieldMapping()
+	tagMapping.Analyzer = keyword.Name
+	tagMapping.Name = tagField
+
+	sourceFacetMapping := bleve.NewTextFieldMapping()
+	sourceFacetMapping.Analyzer = keyword.Name
+	sourceFacetMapping.Name = sourceField
+
+	recipeMapping.AddFieldMappingsAt("source", simpleMapping, sourceFacetMapping)
+	recipeMapping.AddFieldMappingsAt("tags", simpleMapping, tagMapping)
 	recipeMapping.AddSubDocumentMapping("steps", stepsMapping)
+	for _, field := range []string{
+		"preparation_time", "cooking_time", "baking_time", "waiting_time", "total_time",
+		"portions_min", "portions_max", "fan_temp", "top_and_bottom_heat_temp",
+	} {
+		recipeMapping.AddFieldMappingsAt(field, numericMapping)
+	}
 
 	mapping := bleve.NewIndexMapping()
 	mapping.DefaultAnalyzer = "de"
@@ -140,8 +297,46 @@ func createIndex() bleve.Index {
 	return index
 }
 
+// ErrInvalidQuery is returned when a search query cannot be parsed.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Names of the fields containing the verbatim tags and sources
+const (
+	tagField    = "tag"
+	sourceField = "quelle"
+)
+
+// ingredientsField contains the names of the ingredients, analysed like the
+// instructions.
+const ingredientsField = "ingredients"
+
+// Names of the fields containing the allergens and diets of a recipe, in
+// lower case
+const (
+	allergensField = "allergens"
+	dietField      = "diet"
+)
+
+// maxFacets is the maximal number of distinct tags or sources that are
+// counted.
+const maxFacets = 1000
+
+func facetTerms(facets search.FacetResults, name string) []FacetTerm {
+	facet, ok := facets[name]
+	if !ok {
+		return nil
+	}
+	var terms []FacetTerm
+	for _, term := range facet.Terms {
+		if term.Term != "" {
+			terms = append(terms, FacetTerm{term.Term, term.Count})
+		}
+	}
+	return terms
+}
+
 // Search the swish index for a given query.
-func (b Bleve) SearchBleve(queryString string) (Results, error) {
+func (b Bleve) SearchBleve(q Query) (Results, error) {
 	index, err := openIndex()
 	if err != nil {
 		LogError(err)
@@ -149,30 +344,57 @@ func (b Bleve) SearchBleve(queryString string) (Results, error) {
 	}
 	defer index.Close()
 
-	newQueryString := ""
-	for _, tmp := range strings.Split(strings.TrimSpace(queryString), " ") {
-		word := strings.TrimSpace(tmp)
-		if word[0] == '-' || word[0] == '+' {
-			newQueryString += " " + word
-		} else if word[0] == '~' {
-			// Remove prefix to make term optional
-			newQueryString += " " + word[1:]
-		} else {
-			newQueryString += " +" + word
-		}
+	query, err := parseQuery(q.Text)
+	if err != nil {
+		return Results{}, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
 	}
+	query.addTags(q.Tags)
 
-	query := bleve.NewQueryStringQuery(newQueryString[1:]) // Remove leading space
-	search := bleve.NewSearchRequest(query)
+	search := bleve.NewSearchRequest(query.Query())
+	search.From = q.Offset
 	search.Size = Config.MaxResults
+	if q.Limit > 0 {
+		search.Size = q.Limit
+	}
+	if q.Pantry != nil {
+		if len(q.Pantry) == 0 {
+			return Results{}, ErrEmptyPantry
+		}
+		// All candidates have to be ranked before the requested page
+		// can be picked.
+		search = bleve.NewSearchRequest(pantryQuery(query.Query(), q.Pantry))
+		search.Size = maxPantryCandidates
+		search.Fields = []string{ingredientsField}
+	}
+	search.AddFacet(tagField, bleve.NewFacetRequest(tagField, maxFacets))
+	search.AddFacet(sourceField, bleve.NewFacetRequest(sourceField, maxFacets))
 	searchResults, err := index.Search(search)
 	if err != nil {
-		println("Invalid query string: '" + newQueryString[1:] + "'")
+		println("Invalid query string: '" + query.text + "'")
 		LogError(err)
-		return Results{}, err
+		return Results{}, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	results := Results{
+		Total:   int(searchResults.Total),
+		Tags:    facetTerms(searchResults.Facets, tagField),
+		Sources: facetTerms(searchResults.Facets, sourceField),
+	}
+	if q.Pantry != nil {
+		candidates := make([]PantryMatch, len(searchResults.Hits))
+		for i, match := range searchResults.Hits {
+			candidates[i] = q.Pantry.matchNames(Id(match.ID), storedStrings(match.Fields[ingredientsField]))
+		}
+		limit := Config.MaxResults
+		if q.Limit > 0 {
+			limit = q.Limit
+		}
+		recipes, matches := rankPantryCandidates(b.Backend, candidates, q.Pantry, q.Offset+limit)
+		start := min(q.Offset, len(recipes))
+		results.Recipes, results.Pantry = recipes[start:], matches[start:]
+		return results, nil
 	}
 
-	var recipes []ModernistRecipe
 	for _, match := range searchResults.Hits {
 		id := Id(match.ID)
 		recipe, err := b.Backend.ReadRecipe(id)
@@ -181,22 +403,46 @@ func (b Bleve) SearchBleve(queryString string) (Results, error) {
 			recipe.Id = id
 		}
 
-		recipes = append(recipes, recipe)
+		results.Recipes = append(results.Recipes, recipe)
 	}
+	return results, nil
+}
 
-	return Results{recipes[:len(searchResults.Hits)], int(searchResults.Total)}, nil
+// storedStrings converts the value of a stored field, which is a single
+// string unless the field has several values, into a list.
+func storedStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
 }
 
 // Search return a list of all recipes matching the given query.
 func (b Bleve) Search(query string) (Results, error) {
+	return b.SearchQuery(Query{Text: query})
+}
+
+// SearchQuery returns a list of all recipes matching the given query and tag
+// filters.
+func (b Bleve) SearchQuery(query Query) (Results, error) {
 	results, err := b.SearchBleve(query)
 	if err != nil {
 		return Results{}, err
 	}
 	n := len(results.Recipes)
 	recipes := make([]ModernistRecipe, n)
+	var pantry []PantryMatch
 	i := 0
-	for _, recipe := range results.Recipes {
+	for j, recipe := range results.Recipes {
 		if !b.Backend.RecipeExists(recipe.Id) {
 			log.Printf("Could not find file for recipe %s. Removing it from the index.\n", recipe.Id)
 			RemoveFromIndex(recipe.Id)
@@ -204,14 +450,38 @@ func (b Bleve) Search(query string) (Results, error) {
 		}
 
 		recipes[i] = recipe
+		if results.Pantry != nil {
+			pantry = append(pantry, results.Pantry[j])
+		}
 		i += 1
 	}
-	results.Total = n // The number of hits can be wrong if recipes have been deleted
-	results.Recipes = recipes
+	results.Total -= n - i // The number of hits can be wrong if recipes have been deleted
+	results.Recipes = recipes[:i]
+	if results.Pantry != nil {
+		results.Pantry = pantry
+	}
 
 	return results, nil
 }
 
+// Tags counts how many recipes there are for each tag.
+func (Bleve) Tags() ([]FacetTerm, error) {
+	index, err := openIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+
+	search := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	search.Size = 0
+	search.AddFacet(tagField, bleve.NewFacetRequest(tagField, maxFacets))
+	searchResults, err := index.Search(search)
+	if err != nil {
+		return nil, err
+	}
+	return facetTerms(searchResults.Facets, tagField), nil
+}
+
 func (Bleve) ComputeStatistics() Statistics {
 	index, err := openIndex()
 	if err != nil {
@@ -231,3 +501,79 @@ func (Bleve) ComputeStatistics() Statistics {
 
 	return statistics{num, size}
 }
+
+func (b Bleve) ReadRecipe(id Id) (ModernistRecipe, error) {
+	return b.Backend.ReadRecipe(id)
+}
+
+func (b Bleve) RecipeExists(id Id) bool {
+	return b.Backend.RecipeExists(id)
+}
+
+func (b Bleve) Lint(id Id) Diagnostics {
+	return b.Backend.Lint(id)
+}
+
+func (b Bleve) writableBackend() (WritableBackend, error) {
+	backend, ok := b.Backend.(WritableBackend)
+	if !ok {
+		return nil, errors.New("the backend does not support modifying recipes")
+	}
+	return backend, nil
+}
+
+func (b Bleve) ListRecipes() ([]Id, error) {
+	backend, err := b.writableBackend()
+	if err != nil {
+		return nil, err
+	}
+	return backend.ListRecipes()
+}
+
+// ErrIndexNotUpdated is returned when a recipe was changed in the library, but
+// the index could not be updated.  The change itself succeeded; the index is
+// fixed by the next call to BuildIndex.
+var ErrIndexNotUpdated = errors.New("the index could not be updated")
+
+// WriteRecipe stores the recipe and updates the index accordingly.
+func (b Bleve) WriteRecipe(recipe ModernistRecipe) (Id, error) {
+	return b.write(recipe, WritableBackend.WriteRecipe)
+}
+
+// ReplaceRecipe stores the recipe, replacing Markdown or Cooklang files, and
+// updates the index accordingly.
+func (b Bleve) ReplaceRecipe(recipe ModernistRecipe) (Id, error) {
+	return b.write(recipe, WritableBackend.ReplaceRecipe)
+}
+
+func (b Bleve) write(recipe ModernistRecipe, write func(WritableBackend, ModernistRecipe) (Id, error)) (Id, error) {
+	backend, err := b.writableBackend()
+	if err != nil {
+		return "", err
+	}
+	id, err := write(backend, recipe)
+	if err != nil {
+		return id, err
+	}
+
+	recipe.Id = id
+	if err := IndexRecipe(recipe); err != nil {
+		return id, fmt.Errorf("%w: %v", ErrIndexNotUpdated, err)
+	}
+	return id, nil
+}
+
+// DeleteRecipe removes the recipe from both the library and the index.
+func (b Bleve) DeleteRecipe(id Id) error {
+	backend, err := b.writableBackend()
+	if err != nil {
+		return err
+	}
+	if err := backend.DeleteRecipe(id); err != nil {
+		return err
+	}
+	if err := RemoveFromIndex(id); err != nil {
+		return fmt.Errorf("%w: %v", ErrIndexNotUpdated, err)
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package apsa
 import (
 	"html/template"
 	"os"
+
+	"github.com/yzhs/apsa/units"
 )
 
 const (
@@ -29,14 +31,41 @@ type Id string
 type SearchEngine interface {
 	BuildIndex() error
 	Search(query string) (Results, error)
+	SearchQuery(query Query) (Results, error)
+	Tags() ([]FacetTerm, error)
 	ComputeStatistics() Statistics
 }
 
+// Query is a search query together with additional filters.
+type Query struct {
+	Text string
+
+	// Tags the results must have.  Tags prefixed with '-' must not be
+	// present.
+	Tags []string
+
+	// Offset is the number of results to skip, Limit the maximal number of
+	// results to return.  If Limit is zero, Config.MaxResults is used.
+	Offset int
+	Limit  int
+
+	// Pantry, if set, restricts the results to recipes using ingredients
+	// from the pantry and ranks them by how many of their ingredients are
+	// in it.
+	Pantry Pantry
+}
+
 type Renderer interface {
 	Extension() string
 	Render(id Id) error
 }
 
+// CookbookRenderer combines many recipes into a single document.
+type CookbookRenderer interface {
+	Extension() string
+	RenderCookbook(book Cookbook, output string) error
+}
+
 type Statistics interface {
 	Num() int
 	Size() int64
@@ -45,6 +74,23 @@ type Statistics interface {
 type Backend interface {
 	ReadRecipe(id Id) (ModernistRecipe, error)
 	RecipeExists(id Id) bool
+	Lint(id Id) Diagnostics
+}
+
+// WritableBackend is a Backend that can also modify the library.
+type WritableBackend interface {
+	Backend
+	WriteRecipe(recipe ModernistRecipe) (Id, error)
+	ReplaceRecipe(recipe ModernistRecipe) (Id, error)
+	DeleteRecipe(id Id) error
+	ListRecipes() ([]Id, error)
+}
+
+// Library can both search and modify the recipes, keeping the index up to
+// date.
+type Library interface {
+	SearchEngine
+	WritableBackend
 }
 
 // Configuration data of Apsa
@@ -55,6 +101,16 @@ type Configuration struct {
 	// How many results are to be processed at once
 	MaxResults int
 
+	// The LaTeX binary used to typeset recipes, e.g. pdflatex or lualatex
+	LatexBinary string
+
+	// Which file to read a recipe from if it is stored in more than one
+	// format
+	CollisionPolicy CollisionPolicy
+
+	// Which units to display amounts and temperatures in
+	Units units.System
+
 	ApsaDirectory      string
 	KnowledgeDirectory string
 	TemplateDirectory  string
@@ -72,10 +128,11 @@ type Recipe struct {
 	TotalTime            string        `json:"gesamtzeit"`
 	FanTemp              string        `json:"umluft"`
 	TopAndBottomHeatTemp string        `json:"oberuntunterhitze"`
-	Ingredients          []string      `json:"zutaten"`
+	Ingredients          []Ingredient  `json:"zutaten"`
 	Portions             string        `json:"portionen"`
 	Content              string        `json:"inhalt"`
 	Tags                 []string      `json:"tag"`
+	Steps                []Step        `json:"schritte"`
 	HTML                 template.HTML `json:""`
 }
 
@@ -86,6 +143,22 @@ type Results struct {
 	// Total number of results there were all in all; can be significantly
 	// larger than the number of Recipes
 	Total int
+
+	// Tags and Sources contain the number of matching recipes for each tag
+	// and source, respectively.
+	Tags    []FacetTerm
+	Sources []FacetTerm
+
+	// Pantry describes for each recipe which ingredients are missing from
+	// the pantry, if the query used one.
+	Pantry []PantryMatch
+}
+
+// FacetTerm is a tag or source together with the number of recipes it occurs
+// in.
+type FacetTerm struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
 }
 
 var Config Configuration
@@ -93,6 +166,8 @@ var Config Configuration
 func InitConfig() {
 	Config.MaxResults = 1000
 	Config.MaxProcs = 4
+	Config.CollisionPolicy = PreferYaml
+	Config.LatexBinary = "lualatex"
 
 	dir := os.Getenv("HOME") + "/.apsa/"
 
@@ -102,11 +177,18 @@ func InitConfig() {
 	Config.TempDirectory = dir + "tmp/"
 }
 
-func NewSearchEngine() SearchEngine {
-	return Bleve{
-		DefaultBackend{
-			MarkdownParser{FileReaderImpl{}},
-			YamlParser{FileReaderImpl{}},
-		},
+func NewBackend() WritableBackend {
+	return DefaultBackend{
+		MarkdownParser{FileReaderImpl{}},
+		YamlParser{FileReaderImpl{}},
+		CooklangParser{FileReaderImpl{}},
 	}
 }
+
+func NewSearchEngine() SearchEngine {
+	return Bleve{NewBackend()}
+}
+
+func NewLibrary() Library {
+	return Bleve{NewBackend()}
+}
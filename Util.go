@@ -2,7 +2,10 @@ package apsa
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 )
 
 func LogError(err interface{}) {
@@ -40,3 +43,49 @@ func getModTime(file string) (int64, error) {
 	}
 	return info.ModTime().Unix(), nil
 }
+
+// recipeModTime returns the modification time of the newest file belonging
+// to the given recipe.
+func recipeModTime(id Id) (int64, error) {
+	newest := int64(-1)
+	for _, extension := range recipeExtensions {
+		modTime, err := getModTime(Config.KnowledgeDirectory + string(id) + extension)
+		if err != nil && !os.IsNotExist(err) {
+			return -1, err
+		}
+		newest = max(newest, modTime)
+	}
+	return newest, nil
+}
+
+// idFromFileName returns the id of the recipe stored in the given file, if
+// the file is a recipe at all.
+func idFromFileName(filename string) (Id, bool) {
+	extension := path.Ext(filename)
+	for _, recipeExtension := range recipeExtensions {
+		if extension == recipeExtension {
+			return Id(strings.TrimSuffix(filename, extension)), true
+		}
+	}
+	return "", false
+}
+
+// listRecipeIds returns the ids of all recipes in the library.
+func listRecipeIds() ([]Id, error) {
+	files, err := ioutil.ReadDir(Config.KnowledgeDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []Id
+	seen := make(map[Id]bool)
+	for _, file := range files {
+		id, ok := idFromFileName(file.Name())
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
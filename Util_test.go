@@ -0,0 +1,28 @@
+package apsa
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRecipeModTime(t *testing.T) {
+	dir := useLibrary(t)
+	older := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	for file, modTime := range map[string]time.Time{"stollen.md": older, "stollen.yaml": newer} {
+		if err := os.WriteFile(dir+file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dir+file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, err := recipeModTime("stollen"); err != nil || got != newer.Unix() {
+		t.Errorf("recipeModTime(\"stollen\") = %v, %v, want %v", got, err, newer.Unix())
+	}
+	if got, err := recipeModTime("kuchen"); err != nil || got != -1 {
+		t.Errorf("recipeModTime(\"kuchen\") = %v, %v, want -1", got, err)
+	}
+}
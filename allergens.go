@@ -0,0 +1,169 @@
+package apsa
+
+import (
+	_ "embed"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed allergens.yaml
+var allergensYaml []byte
+
+// allergenDictionary maps normalised ingredient names to their allergens and
+// the markers "Fleisch" and "tierisch".
+var allergenDictionary = mustParseAllergens(allergensYaml)
+
+func mustParseAllergens(content []byte) map[string][]string {
+	var dictionary map[string][]string
+	if err := yaml.Unmarshal(content, &dictionary); err != nil {
+		panic("allergens.yaml: " + err.Error())
+	}
+	result := make(map[string][]string, len(dictionary))
+	for ingredient, allergens := range dictionary {
+		result[ingredientKey(ingredient)] = allergens
+	}
+	return result
+}
+
+// Diets a recipe can be classified as.  They are spelled like the tags used
+// for them.
+const (
+	Vegetarian = "vegetarisch"
+	Vegan      = "vegan"
+)
+
+// dietViolations lists for each diet the entries of the allergen dictionary
+// that rule it out.
+var dietViolations = map[string][]string{
+	Vegetarian: {"Fleisch", "Fisch", "Krebstiere", "Weichtiere"},
+	Vegan:      {"Fleisch", "Fisch", "Krebstiere", "Weichtiere", "Milch", "Ei", "tierisch"},
+}
+
+// dietTags maps tags to the diet they claim a recipe to be suitable for.
+var dietTags = map[string]string{
+	"vegetarisch": Vegetarian, "vegetarian": Vegetarian, "vegan": Vegan,
+}
+
+// Classification lists the allergens of a recipe and the diets it is
+// suitable for, as derived from the names of its ingredients.  Ingredients
+// missing from the dictionary are assumed to be free of allergens and vegan.
+type Classification struct {
+	Allergens []string `json:"allergens"`
+	Diets     []string `json:"diets"`
+
+	// conflicts lists the ingredients ruling out each diet.
+	conflicts map[string][]string
+}
+
+// Conflicts returns the ingredients that make the recipe unsuitable for the
+// given diet.
+func (c Classification) Conflicts(diet string) []string {
+	return c.conflicts[diet]
+}
+
+// Classify derives the allergens and diets of a recipe from its ingredients.
+func Classify(recipe ModernistRecipe) Classification {
+	result := Classification{conflicts: make(map[string][]string)}
+	allergens := make(map[string]bool)
+	for _, item := range mergeIngredients([]ModernistRecipe{recipe}) {
+		classes := ingredientAllergens(item.Name)
+		for _, class := range classes {
+			if class != "Fleisch" && class != "tierisch" {
+				allergens[class] = true
+			}
+		}
+		for diet, violations := range dietViolations {
+			if containsAny(classes, violations) {
+				result.conflicts[diet] = append(result.conflicts[diet], item.Name)
+			}
+		}
+	}
+
+	for allergen := range allergens {
+		result.Allergens = append(result.Allergens, allergen)
+	}
+	sort.Strings(result.Allergens)
+	for _, diet := range []string{Vegetarian, Vegan} {
+		if len(result.conflicts[diet]) == 0 {
+			result.Diets = append(result.Diets, diet)
+		}
+	}
+	return result
+}
+
+// ingredientAllergens looks up an ingredient in the allergen dictionary.
+// Unlike the store section, which depends on the end of a compound like
+// "Weizenmehl", allergens can hide in any part of it, as in "Mandelstifte" or
+// "Vollmilchschokolade".  Entries of three or more letters are therefore
+// found anywhere in the name, shorter ones only as whole words.  Where
+// matches overlap, the longest one wins, so that exceptions like
+// "Kokosmilch" are not also counted as "Milch".
+func ingredientAllergens(name string) []string {
+	name = ingredientKey(name)
+	type match struct {
+		entry      string
+		start, end int
+	}
+	var matches []match
+	for entry := range allergenDictionary {
+		if utf8.RuneCountInString(entry) < 3 {
+			if i := findWord(name, entry); i >= 0 {
+				matches = append(matches, match{entry, i, i + len(entry)})
+			}
+			continue
+		}
+		for offset := 0; ; {
+			i := strings.Index(name[offset:], entry)
+			if i < 0 {
+				break
+			}
+			matches = append(matches, match{entry, offset + i, offset + i + len(entry)})
+			offset += i + 1
+		}
+	}
+	// Ties are broken alphabetically to keep the result independent of the
+	// order of the map.
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.end-a.start != b.end-b.start {
+			return a.end-a.start > b.end-b.start
+		}
+		return a.entry < b.entry
+	})
+
+	var result []string
+	var used []match
+	for _, m := range matches {
+		overlaps := false
+		for _, u := range used {
+			if m.start < u.end && u.start < m.end {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+		used = append(used, m)
+		for _, class := range allergenDictionary[m.entry] {
+			if !containsAny(result, []string{class}) {
+				result = append(result, class)
+			}
+		}
+	}
+	return result
+}
+
+func containsAny(list, values []string) bool {
+	for _, x := range list {
+		for _, value := range values {
+			if strings.EqualFold(x, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
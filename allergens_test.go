@@ -0,0 +1,88 @@
+package apsa
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIngredientAllergens(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"Mehl", []string{"Gluten"}},
+		{"Weizenmehl", []string{"Gluten"}},
+		{"Mandelstifte", []string{"Nüsse"}},
+		{"gehobelte Mandeln", []string{"Nüsse"}},
+		{"Walnusskerne", []string{"Nüsse"}},
+		{"Vollmilchschokolade", []string{"Milch"}},
+		{"Milchreis", []string{"Milch"}},
+		{"Vollei", []string{"Ei"}},
+		{"Ei", []string{"Ei"}},
+		{"Eischnee", []string{"Ei"}},
+		{"Eidotter", []string{"Ei"}},
+		{"Hühnereier", []string{"Ei"}},
+		{"Reis", nil},
+		{"Kokosmilch", nil},
+		{"Mandelmilch", []string{"Nüsse"}},
+		{"Erdnussbutter", []string{"Erdnüsse"}},
+		{"Muskatnuss", nil},
+		{"Buchweizenmehl", nil},
+		{"Butternutkürbis", nil},
+		{"Weinsteinbackpulver", nil},
+		{"Schweinefilet", []string{"Fleisch"}},
+		{"Putenbrust", []string{"Fleisch"}},
+		{"Lammkeule", []string{"Fleisch"}},
+		{"Kalbsschnitzel", []string{"Fleisch"}},
+		{"Entenbrust", []string{"Fleisch"}},
+		{"Gänsekeule", []string{"Fleisch"}},
+		{"Wildgulasch", []string{"Fleisch"}},
+		{"Rehrücken", []string{"Fleisch"}},
+		{"Hirschragout", []string{"Fleisch"}},
+		{"Hack", []string{"Fleisch"}},
+		{"Hackfleisch", []string{"Fleisch"}},
+		{"Mandeln, gehackt", []string{"Nüsse"}},
+		{"Wildkräuter", nil},
+		{"Wildreis", nil},
+		{"Flammkuchenteig", []string{"Gluten"}},
+		{"Käsespätzle", []string{"Milch"}},
+		{"Sesambrötchen", []string{"Gluten", "Sesam"}},
+		{"Zucker", nil},
+	}
+	for _, test := range tests {
+		got := ingredientAllergens(test.name)
+		sort.Strings(got)
+		if len(got) == 0 && len(test.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ingredientAllergens(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		recipe    ModernistRecipe
+		allergens []string
+		diets     []string
+	}{
+		{testRecipe("test", "500g Weizenmehl", "1 Würfel Hefe", "Salz"), []string{"Gluten"}, []string{Vegetarian, Vegan}},
+		{testRecipe("test", "200g Mehl", "2 Eier", "400ml Milch"), []string{"Ei", "Gluten", "Milch"}, []string{Vegetarian}},
+		{testRecipe("test", "100g Mandelstifte", "200g Vollmilchschokolade"), []string{"Milch", "Nüsse"}, []string{Vegetarian}},
+		{testRecipe("test", "400ml Kokosmilch", "1 EL Honig"), nil, []string{Vegetarian}},
+		{testRecipe("test", "200g Speck", "1 Zwiebel"), nil, nil},
+		{testRecipe("test", "1 Lammkeule", "2 Zweige Rosmarin"), nil, nil},
+		{testRecipe("test", "500g Hack", "1 Zwiebel"), nil, nil},
+		{testRecipe("test", "Eischnee", "100g Zucker"), []string{"Ei"}, []string{Vegetarian}},
+		{testRecipe("test", "300g Wildreis", "50g gehackte Mandeln"), []string{"Nüsse"}, []string{Vegetarian, Vegan}},
+	}
+	for _, test := range tests {
+		got := Classify(test.recipe)
+		if !reflect.DeepEqual(got.Allergens, test.allergens) || !reflect.DeepEqual(got.Diets, test.diets) {
+			t.Errorf("Classify(%v) = %v and %v, want %v and %v", test.recipe.Steps[0].Ingredients,
+				got.Allergens, got.Diets, test.allergens, test.diets)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	backend "github.com/yzhs/apsa"
+)
+
+// Maximal number of recipes returned by a single API search
+const maxApiLimit = 100
+
+// ApiError is the body of all error responses of the JSON API.
+type ApiError struct {
+	Error ApiErrorDetails `json:"error"`
+}
+
+type ApiErrorDetails struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// SearchResponse is the body of a successful search request.
+type SearchResponse struct {
+	Query   string                    `json:"query"`
+	Tags    []string                  `json:"tags"`
+	Offset  int                       `json:"offset"`
+	Limit   int                       `json:"limit"`
+	Total   int                       `json:"total"`
+	Recipes []backend.ModernistRecipe `json:"recipes"`
+
+	TagFacets    []backend.FacetTerm `json:"tag_facets"`
+	SourceFacets []backend.FacetTerm `json:"source_facets"`
+}
+
+// StatsResponse is the body of a successful statistics request.
+type StatsResponse struct {
+	Recipes int   `json:"recipes"`
+	Size    int64 `json:"size"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	backend.TryLogError(encoder.Encode(data))
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ApiError{ApiErrorDetails{status, message}})
+}
+
+// intParam reads a non-negative integer parameter, falling back to the given
+// default if it is missing.
+func intParam(r *http.Request, name string, fallback int) (int, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return fallback, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil || result < 0 {
+		return 0, errors.New("invalid value for parameter '" + name + "': " + value)
+	}
+	return result, nil
+}
+
+func (c Controller) apiSearchHandler(w http.ResponseWriter, r *http.Request) {
+	offset, err := intParam(r, "offset", 0)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := intParam(r, "limit", 20)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit = min(max(limit, 1), maxApiLimit)
+
+	query := backend.Query{
+		Text:   r.FormValue("q"),
+		Tags:   r.Form["tag"],
+		Offset: offset,
+		Limit:  limit,
+	}
+	results, err := c.searchEngine.SearchQuery(query)
+	if errors.Is(err, backend.ErrInvalidQuery) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		log.Println("Search failed:", err)
+		writeJSONError(w, http.StatusInternalServerError, "search failed")
+		return
+	}
+
+	recipes := results.Recipes
+	if recipes == nil {
+		recipes = []backend.ModernistRecipe{}
+	}
+	if query.Tags == nil {
+		query.Tags = []string{}
+	}
+	writeJSON(w, http.StatusOK, SearchResponse{
+		Query:        query.Text,
+		Tags:         query.Tags,
+		Offset:       offset,
+		Limit:        limit,
+		Total:        results.Total,
+		Recipes:      recipes,
+		TagFacets:    results.Tags,
+		SourceFacets: results.Sources,
+	})
+}
+
+// Serve a single recipe, or its schema.org description if the id ends in
+// ".jsonld".
+func (c Controller) apiRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	id := backend.Id(r.PathValue("id"))
+	if !backend.ValidId(id) {
+		writeJSONError(w, http.StatusNotFound, "no such recipe: "+string(id))
+		return
+	}
+	jsonLd := false
+	if stripped, ok := strings.CutSuffix(string(id), ".jsonld"); ok && !c.library.RecipeExists(id) {
+		id, jsonLd = backend.Id(stripped), true
+	}
+	if !backend.ValidId(id) || !c.library.RecipeExists(id) {
+		writeJSONError(w, http.StatusNotFound, "no such recipe: "+string(id))
+		return
+	}
+
+	recipe, ok := apiReadRecipe(c.library, w, r, id)
+	if !ok {
+		return
+	}
+	system, err := unitsParam(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recipes := []backend.ModernistRecipe{recipe}
+	convertUnits(recipes, system)
+	recipe = recipes[0]
+
+	if jsonLd {
+		w.Header().Set("Content-Type", "application/ld+json; charset=utf-8")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		backend.TryLogError(encoder.Encode(backend.ToSchemaOrg(recipe)))
+		return
+	}
+	writeJSON(w, http.StatusOK, recipe)
+}
+
+// apiReadRecipe reads a recipe and scales it to the number of portions
+// requested by the client, if any.  Errors are sent to the client.
+func apiReadRecipe(library backend.Backend, w http.ResponseWriter, r *http.Request, id backend.Id) (backend.ModernistRecipe, bool) {
+	recipe, err := library.ReadRecipe(id)
+	if err != nil {
+		log.Println("Error reading recipe:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not read the recipe")
+		return recipe, false
+	}
+
+	if portions := r.FormValue("portions"); portions != "" {
+		value, err := strconv.ParseFloat(portions, 64)
+		if err != nil || value <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "invalid number of portions: "+portions)
+			return recipe, false
+		}
+		recipe, err = backend.ScaleToPortions(recipe, value)
+		if err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return recipe, false
+		}
+	}
+	return recipe, true
+}
+
+// Send the estimated nutritional value of a recipe.
+func (c Controller) apiNutritionHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := c.recipeId(r)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "no such recipe: "+string(id))
+		return
+	}
+	recipe, ok := apiReadRecipe(c.library, w, r, id)
+	if !ok {
+		return
+	}
+
+	nutrients, err := backend.ReadNutrientTable()
+	if err != nil {
+		log.Println("Error reading nutrient table:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not read the nutrient table")
+		return
+	}
+	nutrition := nutrients.Estimate(recipe)
+	if nutrition.Unmatched == nil {
+		nutrition.Unmatched = []backend.ShoppingItem{}
+	}
+	writeJSON(w, http.StatusOK, nutrition)
+}
+
+func (c Controller) apiStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := c.searchEngine.ComputeStatistics()
+	writeJSON(w, http.StatusOK, StatsResponse{stats.Num(), stats.Size()})
+}
+
+func (c Controller) apiTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := c.searchEngine.Tags()
+	if err != nil {
+		log.Println("Could not count tags:", err)
+		writeJSONError(w, http.StatusInternalServerError, "could not count tags")
+		return
+	}
+	if tags == nil {
+		tags = []backend.FacetTerm{}
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+func (c Controller) registerApiHandlers() {
+	http.HandleFunc("GET /api/v1/search", c.apiSearchHandler)
+	http.HandleFunc("GET /api/v1/recipes/{id}", c.apiRecipeHandler)
+	http.HandleFunc("GET /api/v1/recipes/{id}/nutrition", c.apiNutritionHandler)
+	http.HandleFunc("GET /api/v1/stats", c.apiStatsHandler)
+	http.HandleFunc("GET /api/v1/tags", c.apiTagsHandler)
+	http.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "no such endpoint: "+r.URL.Path)
+	})
+}
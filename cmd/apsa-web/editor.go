@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	backend "github.com/yzhs/apsa"
+)
+
+// RecipeForm contains the values of the fields of the recipe editor as
+// entered by the user.
+type RecipeForm struct {
+	Title    string
+	Portions string
+	Source   string
+
+	// Tags is a comma separated list of tags
+	Tags string
+
+	PreparationTime string
+	CookingTime     string
+	BakingTime      string
+	WaitingTime     string
+	TotalTime       string
+
+	FanTemp              string
+	TopAndBottomHeatTemp string
+
+	Steps []StepForm
+}
+
+// StepForm contains the values of the fields describing a single step.
+type StepForm struct {
+	Title string
+
+	// Ingredients contains one ingredient per line
+	Ingredients string
+
+	Instructions string
+}
+
+// EditPage is the data needed to render the recipe editor.
+type EditPage struct {
+	// Id is empty when creating a new recipe
+	Id   backend.Id
+	Form RecipeForm
+
+	// Errors maps the names of form fields like "title" or "step-2" to
+	// problems with their values.  "replace" is set if the recipe is stored
+	// as Markdown or Cooklang; the form then has to offer a checkbox named
+	// "replace" with the value "1" to store it as YAML instead.
+	Errors map[string]string
+
+	// Warnings contains problems that do not prevent saving the recipe.
+	Warnings []string
+}
+
+func formatTemperature(t *backend.Temperature) string {
+	if t == nil {
+		return ""
+	}
+	return strconv.FormatFloat(t.Degrees, 'f', -1, 64) + t.Unit
+}
+
+func newRecipeForm(recipe backend.ModernistRecipe) RecipeForm {
+	form := RecipeForm{
+		Title:    recipe.Title,
+		Portions: recipe.Portions,
+		Source:   recipe.Source,
+		Tags:     strings.Join(recipe.Tags, ", "),
+
+		PreparationTime: recipe.PreparationTime.String(),
+		CookingTime:     recipe.CookingTime.String(),
+		BakingTime:      recipe.BakingTime.String(),
+		WaitingTime:     recipe.WaitingTime.String(),
+		TotalTime:       recipe.TotalTime.String(),
+
+		FanTemp:              formatTemperature(recipe.FanTemp),
+		TopAndBottomHeatTemp: formatTemperature(recipe.TopAndBottomHeatTemp),
+	}
+	for _, step := range recipe.Steps {
+		stepForm := StepForm{Instructions: step.Instructions}
+		if step.Title != nil {
+			stepForm.Title = *step.Title
+		}
+		var ingredients []string
+		for _, ingredient := range step.Ingredients {
+			ingredients = append(ingredients, ingredient.String())
+		}
+		stepForm.Ingredients = strings.Join(ingredients, "\n")
+		form.Steps = append(form.Steps, stepForm)
+	}
+	return form
+}
+
+// parseRecipeForm reads the submitted form.  The fields of the steps are
+// repeated once per step.  Steps where all fields are empty are ignored.
+func parseRecipeForm(r *http.Request) RecipeForm {
+	form := RecipeForm{
+		Title:    r.FormValue("title"),
+		Portions: r.FormValue("portions"),
+		Source:   r.FormValue("source"),
+		Tags:     r.FormValue("tags"),
+
+		PreparationTime: r.FormValue("preparation_time"),
+		CookingTime:     r.FormValue("cooking_time"),
+		BakingTime:      r.FormValue("baking_time"),
+		WaitingTime:     r.FormValue("waiting_time"),
+		TotalTime:       r.FormValue("total_time"),
+
+		FanTemp:              r.FormValue("fan_temp"),
+		TopAndBottomHeatTemp: r.FormValue("top_and_bottom_heat_temp"),
+	}
+
+	titles := r.PostForm["step_title"]
+	ingredients := r.PostForm["step_ingredients"]
+	instructions := r.PostForm["step_instructions"]
+	n := max(len(titles), len(ingredients), len(instructions))
+	get := func(values []string, i int) string {
+		if i < len(values) {
+			return strings.TrimSpace(values[i])
+		}
+		return ""
+	}
+	for i := 0; i < n; i++ {
+		step := StepForm{get(titles, i), get(ingredients, i), get(instructions, i)}
+		if step != (StepForm{}) {
+			form.Steps = append(form.Steps, step)
+		}
+	}
+	return form
+}
+
+// Recipe converts the form into a recipe.  Problems with the values entered
+// are returned, keyed by the name of the field.
+func (form RecipeForm) Recipe(id backend.Id) (backend.ModernistRecipe, map[string]string) {
+	errs := make(map[string]string)
+	recipe := backend.ModernistRecipe{
+		Id:       id,
+		Title:    strings.TrimSpace(form.Title),
+		Portions: strings.TrimSpace(form.Portions),
+		Source:   strings.TrimSpace(form.Source),
+	}
+	if recipe.Title == "" {
+		errs["title"] = "Der Titel darf nicht leer sein."
+	}
+	for _, tag := range strings.Split(form.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			recipe.Tags = append(recipe.Tags, tag)
+		}
+	}
+
+	durations := []struct {
+		field  string
+		value  string
+		target *backend.Duration
+	}{
+		{"preparation_time", form.PreparationTime, &recipe.PreparationTime},
+		{"cooking_time", form.CookingTime, &recipe.CookingTime},
+		{"baking_time", form.BakingTime, &recipe.BakingTime},
+		{"waiting_time", form.WaitingTime, &recipe.WaitingTime},
+		{"total_time", form.TotalTime, &recipe.TotalTime},
+	}
+	for _, d := range durations {
+		var err error
+		*d.target, err = backend.ParseDuration(d.value)
+		if err != nil {
+			errs[d.field] = err.Error()
+		}
+	}
+
+	var err error
+	recipe.FanTemp, err = backend.ParseTemperature(form.FanTemp, backend.FanHeating)
+	if err != nil {
+		errs["fan_temp"] = err.Error()
+	}
+	recipe.TopAndBottomHeatTemp, err = backend.ParseTemperature(form.TopAndBottomHeatTemp, backend.TopAndBottomHeating)
+	if err != nil {
+		errs["top_and_bottom_heat_temp"] = err.Error()
+	}
+
+	if len(form.Steps) == 0 {
+		errs["steps"] = "Das Rezept braucht mindestens einen Schritt."
+	}
+	for i, stepForm := range form.Steps {
+		step := backend.Step{Instructions: stepForm.Instructions}
+		if stepForm.Title != "" {
+			title := stepForm.Title
+			step.Title = &title
+		}
+		for _, line := range strings.Split(stepForm.Ingredients, "\n") {
+			if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "* ")); line != "" {
+				step.Ingredients = append(step.Ingredients, backend.ParseIngredient(line))
+			}
+		}
+		if step.Instructions == "" && len(step.Ingredients) == 0 {
+			errs["step-"+strconv.Itoa(i)] = "Der Schritt braucht Zutaten oder eine Anleitung."
+		}
+		recipe.Steps = append(recipe.Steps, step)
+	}
+
+	return recipe, errs
+}
+
+// Show the editor for a new recipe.
+func (c Controller) newHandler(w http.ResponseWriter, r *http.Request) {
+	form := RecipeForm{Steps: []StepForm{{}}}
+	renderTemplate(w, "edit", EditPage{Form: form})
+}
+
+// Show the editor for an existing recipe.
+func (c Controller) editHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := c.recipeId(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	recipe, err := c.library.ReadRecipe(id)
+	if err != nil {
+		log.Println("Error reading recipe:", err)
+		http.Error(w, "Could not read the recipe", http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "edit", EditPage{Id: id, Form: newRecipeForm(recipe)})
+}
+
+// Save a recipe submitted through the editor.  If there are problems, the
+// editor is shown again together with error messages.
+func (c Controller) saveHandler(w http.ResponseWriter, r *http.Request) {
+	id := backend.Id(r.PathValue("id"))
+	if id != "" && !(backend.ValidId(id) && c.library.RecipeExists(id)) {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	form := parseRecipeForm(r)
+	recipe, errs := form.Recipe(id)
+	page := EditPage{Id: id, Form: form, Errors: errs, Warnings: validationWarnings(recipe)}
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		renderTemplate(w, "edit", page)
+		return
+	}
+
+	write := c.library.WriteRecipe
+	if r.FormValue("replace") == "1" {
+		write = c.library.ReplaceRecipe
+	}
+	newId, err := write(recipe)
+	if errors.Is(err, backend.ErrIndexNotUpdated) {
+		// The recipe was saved, so do not make the user submit it again.
+		log.Println("Error saving recipe:", err)
+	} else if errors.Is(err, backend.ErrNotYaml) {
+		page.Errors["replace"] = "Das Rezept ist als Markdown oder Cooklang gespeichert " +
+			"und wird beim Speichern durch eine YAML-Datei ersetzt."
+		w.WriteHeader(http.StatusConflict)
+		renderTemplate(w, "edit", page)
+		return
+	} else if err != nil {
+		log.Println("Error saving recipe:", err)
+		page.Errors["save"] = err.Error()
+		w.WriteHeader(http.StatusInternalServerError)
+		renderTemplate(w, "edit", page)
+		return
+	}
+
+	// Relative redirect, so that it works no matter where apsa-web is
+	// mounted.  The recipe page then checks the recipe for warnings again.
+	location := "recipe/" + url.PathEscape(string(newId))
+	if id != "" {
+		location = "../" + url.PathEscape(string(newId))
+	}
+	w.Header().Set("Location", location+"?saved=1")
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// validationWarnings lists the problems that do not prevent saving a recipe.
+func validationWarnings(recipe backend.ModernistRecipe) []string {
+	var warnings []string
+	for _, diagnostic := range backend.Validate(recipe) {
+		if diagnostic.Severity == backend.Warning {
+			warnings = append(warnings, diagnostic.Message)
+		}
+	}
+	return warnings
+}
+
+// Render the Markdown sent by the editor for the live preview the same way as
+// the recipe page does.  The editor posts the instructions of a step as the
+// form field "text" and inserts the response into the page.
+func previewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(renderMarkdown(r.FormValue("text")))
+}
+
+// sameOrigin rejects requests sent by other sites, so that they cannot make
+// the browser of a user change recipes.  Browsers tell where a request comes
+// from using the Sec-Fetch-Site header, older ones only using Origin.
+// Requests without either header do not come from a browser.
+func sameOrigin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		site := r.Header.Get("Sec-Fetch-Site")
+		origin := r.Header.Get("Origin")
+		switch {
+		case site == "same-origin" || site == "none":
+		case site != "":
+			http.Error(w, "Cross-site requests are not allowed", http.StatusForbidden)
+			return
+		case origin != "":
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "Cross-site requests are not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// Handle old edit-links by redirecting to the editor.
+func legacyEditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Location", "recipe/"+url.PathEscape(r.FormValue("id"))+"/edit")
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+func (c Controller) registerEditorHandlers() {
+	http.HandleFunc("GET /new", c.newHandler)
+	http.HandleFunc("POST /new", sameOrigin(c.saveHandler))
+	http.HandleFunc("GET /recipe/{id}/edit", c.editHandler)
+	http.HandleFunc("POST /recipe/{id}/edit", sameOrigin(c.saveHandler))
+	http.HandleFunc("POST /preview", sameOrigin(previewHandler))
+	http.HandleFunc("/apsa.apsaedit", legacyEditHandler)
+}
@@ -1,20 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
-	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	flag "github.com/ogier/pflag"
 	"github.com/russross/blackfriday"
 
 	backend "github.com/yzhs/apsa"
+	"github.com/yzhs/apsa/units"
 )
 
 const SocketPath = "/var/run/apsa/apsa.sock"
@@ -27,36 +30,45 @@ func (c Controller) statsHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "The library contains %v recipes with a total size of %.1f kiB.\n", n, size)
 }
 
-// Handle the edit-link, causing the browser to open that recipe in an editor.
-func editHandler(w http.ResponseWriter, r *http.Request) {
-	headers := w.Header()
-	headers["Content-Type"] = []string{"application/x-apsa-edit"}
-	id := r.FormValue("id")
-	fmt.Fprint(w, id)
-}
-
-// Serve the search page.
-func mainHandler(w http.ResponseWriter, r *http.Request) {
-	html, err := loadHTMLTemplate("main")
-	if err != nil {
-		fmt.Fprintf(w, "%v", err)
-		return
-	}
-	fmt.Fprintln(w, string(html))
-}
-
-func loadHTMLTemplate(name string) ([]byte, error) {
-	return ioutil.ReadFile(backend.Config.TemplateDirectory + name + ".html")
+// Serve the search page together with a tag cloud.  main.html is executed as
+// a template with a MainPage.
+func (c Controller) mainHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := c.searchEngine.Tags()
+	backend.TryLogError(err)
+	renderTemplate(w, "main", MainPage{TagCloud: newTagCloud(tags)})
 }
 
+// Result is the data needed to render search.html.  The facets can be turned
+// into links using TagURL, ExcludeTagURL and RemoveTagURL, e.g.
+//
+//	{{range .TagFacets}}<a href="{{$.TagURL .Term}}">{{.Term}}</a> ({{.Count}})
+//	<a href="{{$.ExcludeTagURL .Term}}">ohne</a>{{end}}
+//	{{range .Tags}}<a href="{{$.RemoveTagURL .}}">{{.}} ✕</a>{{end}}
 type Result struct {
 	Query        string
+	Portions     string
+	Units        units.System
 	Matches      []backend.ModernistRecipe
 	NumMatches   int
 	TotalMatches int
+
+	// Tags contains the tag filters currently applied
+	Tags []string
+
+	// TagFacets and SourceFacets count the matches for each tag and source
+	TagFacets    []backend.FacetTerm
+	SourceFacets []backend.FacetTerm
+
+	// UsePantry is set if the search was restricted to what can be cooked
+	// with the pantry.  Pantry then lists the missing ingredients for each
+	// match.
+	UsePantry bool
+	Pantry    []backend.PantryMatch
 }
 
 var funcMap = template.FuncMap{
+	// Badges for allergens and diets, e.g. {{with classify .}}{{.Allergens}}{{end}}
+	"classify": backend.Classify,
 	"link": func(x string) template.HTML {
 		if strings.HasPrefix(x, "http://") || strings.HasPrefix(x, "https://") {
 			return template.HTML("<a href=\"" + x + "\">" + x + "</a>")
@@ -64,22 +76,51 @@ var funcMap = template.FuncMap{
 		return template.HTML(template.HTMLEscapeString(x))
 	},
 	"markdown": func(x string) template.HTML {
-		r := blackfriday.MarkdownCommon([]byte(x))
-		return template.HTML(r)
+		return template.HTML(renderMarkdown(x))
 	},
 }
 
-func renderTemplate(w io.Writer, templateName string, resultData Result) {
+// renderMarkdown converts Markdown like blackfriday.MarkdownCommon, but drops
+// raw HTML and unsafe links.  Anyone who can reach the editor can change the
+// instructions, so they must not be able to run scripts on the pages.
+func renderMarkdown(text string) []byte {
+	flags := blackfriday.HTML_USE_XHTML |
+		blackfriday.HTML_USE_SMARTYPANTS |
+		blackfriday.HTML_SMARTYPANTS_FRACTIONS |
+		blackfriday.HTML_SMARTYPANTS_DASHES |
+		blackfriday.HTML_SMARTYPANTS_LATEX_DASHES |
+		blackfriday.HTML_SKIP_HTML |
+		blackfriday.HTML_SAFELINK
+	extensions := blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
+		blackfriday.EXTENSION_TABLES |
+		blackfriday.EXTENSION_FENCED_CODE |
+		blackfriday.EXTENSION_AUTOLINK |
+		blackfriday.EXTENSION_STRIKETHROUGH |
+		blackfriday.EXTENSION_SPACE_HEADERS |
+		blackfriday.EXTENSION_HEADER_IDS |
+		blackfriday.EXTENSION_BACKSLASH_LINE_BREAK |
+		blackfriday.EXTENSION_DEFINITION_LISTS
+	return blackfriday.Markdown([]byte(text), blackfriday.HtmlRenderer(flags, "", ""), extensions)
+}
+
+// renderTemplate executes a template with the given data.  The page is only
+// sent once it was rendered completely, so that the client gets an error
+// instead of half a page if the template is broken.
+func renderTemplate(w http.ResponseWriter, templateName string, resultData interface{}) {
 	tmplFile := backend.Config.TemplateDirectory + templateName + ".html"
 	t, err := template.New(templateName + ".html").Funcs(funcMap).ParseFiles(tmplFile)
 	if err != nil {
-		fmt.Fprintf(w, "Error: %v", err)
+		log.Println("Error parsing template:", err)
+		http.Error(w, "Could not render the page", http.StatusInternalServerError)
 		return
 	}
-	err = t.ExecuteTemplate(w, templateName+".html", resultData)
-	if err != nil {
-		log.Fatal(err)
+	var page bytes.Buffer
+	if err := t.ExecuteTemplate(&page, templateName+".html", resultData); err != nil {
+		log.Println("Error executing template:", err)
+		http.Error(w, "Could not render the page", http.StatusInternalServerError)
+		return
 	}
+	page.WriteTo(w)
 }
 
 func min(a, b int) int {
@@ -91,25 +132,176 @@ func min(a, b int) int {
 
 type Controller struct {
 	searchEngine backend.SearchEngine
+	library      backend.WritableBackend
+}
+
+// scaleRecipes scales all recipes to the number of portions requested by the
+// client, if any.  If the number is invalid, an error is sent to the client
+// and false is returned.
+func scaleRecipes(w http.ResponseWriter, portionsParam string, recipes []backend.ModernistRecipe) bool {
+	if portionsParam == "" {
+		return true
+	}
+	portions, err := strconv.ParseFloat(portionsParam, 64)
+	if err != nil || portions <= 0 {
+		http.Error(w, "Invalid number of portions: "+portionsParam, http.StatusBadRequest)
+		return false
+	}
+	for i, recipe := range recipes {
+		scaled, err := backend.ScaleToPortions(recipe, portions)
+		if err != nil {
+			backend.LogError(err)
+			continue
+		}
+		recipes[i] = scaled
+	}
+	return true
+}
+
+// RecipePage is the data needed to render a single recipe.
+type RecipePage struct {
+	Recipe   backend.ModernistRecipe
+	Portions string
+	Units    units.System
+
+	// JsonLd describes the recipe using schema.org, to be embedded in a
+	// <script type="application/ld+json"> element.
+	JsonLd template.JS
+
+	// Nutrition is nil if the nutrient table could not be read.
+	Nutrition *backend.Nutrition
+
+	// Warnings contains problems with the recipe shown right after saving it
+	// in the editor.
+	Warnings []string
+}
+
+// recipeId returns the id of the recipe requested by the client, if it is
+// valid and the recipe exists.
+func (c Controller) recipeId(r *http.Request) (backend.Id, bool) {
+	id := backend.Id(r.PathValue("id"))
+	return id, backend.ValidId(id) && c.library.RecipeExists(id)
+}
+
+// Serve a single recipe.
+func (c Controller) recipeHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := c.recipeId(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	recipe, err := c.library.ReadRecipe(id)
+	if err != nil {
+		log.Println("Error reading recipe:", err)
+		http.Error(w, "Could not read the recipe", http.StatusInternalServerError)
+		return
+	}
+
+	portionsParam := r.FormValue("portions")
+	recipes := []backend.ModernistRecipe{recipe}
+	if !scaleRecipes(w, portionsParam, recipes) {
+		return
+	}
+	system, ok := unitSystem(w, r)
+	if !ok {
+		return
+	}
+
+	page := RecipePage{Portions: portionsParam, Units: system}
+	if r.FormValue("saved") == "1" {
+		page.Warnings = validationWarnings(recipe)
+	}
+	if nutrients, err := backend.ReadNutrientTable(); err != nil {
+		log.Println("Error reading nutrient table:", err)
+	} else {
+		nutrition := nutrients.Estimate(recipes[0])
+		page.Nutrition = &nutrition
+	}
+	convertUnits(recipes, system)
+	page.Recipe = recipes[0]
+
+	jsonLd, err := json.Marshal(backend.ToSchemaOrg(recipes[0]))
+	backend.TryLogError(err)
+	page.JsonLd = template.JS(jsonLd)
+	renderTemplate(w, "recipe", page)
+}
+
+// renderedRecipeHandler serves a single recipe rendered to a file, e.g. a PDF.
+func (c Controller) renderedRecipeHandler(renderer renderer, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := c.recipeId(r)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := renderer.Render(id); err != nil {
+			log.Println("Error rendering recipe:", err)
+			http.Error(w, "Could not render the recipe", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		http.ServeFile(w, r, renderer.OutputFile(id))
+	}
+}
+
+// renderer is a backend.Renderer storing its output in a file.
+type renderer interface {
+	backend.Renderer
+	OutputFile(id backend.Id) string
 }
 
 // Handle a query and serve the results.
 func (c Controller) queryHandler(w http.ResponseWriter, r *http.Request) {
 	query := r.FormValue("q")
-	if query == "" {
-		mainHandler(w, r)
+	tags := r.Form["tag"]
+	usePantry := r.FormValue("pantry") == "1"
+	if query == "" && len(tags) == 0 && !usePantry {
+		c.mainHandler(w, r)
 		return
 	}
 
-	results, err := c.searchEngine.Search(query)
-	if err != nil {
-		panic(err)
+	searchQuery := backend.Query{Text: query, Tags: tags}
+	if usePantry {
+		pantry, err := backend.ReadPantry(backend.PantryFile())
+		if err != nil {
+			log.Println("Error reading pantry:", err)
+			http.Error(w, "Could not read the pantry", http.StatusInternalServerError)
+			return
+		}
+		searchQuery.Pantry = pantry
+	}
+
+	results, err := c.searchEngine.SearchQuery(searchQuery)
+	if errors.Is(err, backend.ErrInvalidQuery) || errors.Is(err, backend.ErrEmptyPantry) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Println("Search failed:", err)
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
 	}
 	numMatches := len(results.Recipes)
+	matches := results.Recipes[:min(20, numMatches)]
+
+	portionsParam := r.FormValue("portions")
+	if !scaleRecipes(w, portionsParam, matches) {
+		return
+	}
+	system, ok := unitSystem(w, r)
+	if !ok {
+		return
+	}
+	convertUnits(matches, system)
 
 	data := Result{
-		Query: query, NumMatches: numMatches, Matches: results.Recipes[:min(20, numMatches)],
-		TotalMatches: results.Total,
+		Query: query, Portions: portionsParam, Units: system, NumMatches: numMatches, Matches: matches,
+		TotalMatches: results.Total, Tags: tags,
+		TagFacets: results.Tags, SourceFacets: results.Sources, UsePantry: usePantry,
+	}
+	if usePantry {
+		data.Pantry = results.Pantry[:len(matches)]
 	}
 	renderTemplate(w, "search", data)
 }
@@ -120,23 +312,32 @@ func serveDirectory(prefix string, directory string) {
 
 func main() {
 	var version bool
+	var collisions backend.CollisionPolicy
 	flag.BoolVarP(&version, "version", "v", false, "\tShow version")
+	flag.Var(&collisions, "collisions", "\tWhich file to use for recipes stored more than once: yaml, newest or error")
 	flag.Parse()
 
 	backend.InitConfig()
 	backend.Config.MaxResults = 20
+	backend.Config.CollisionPolicy = collisions
 
 	if version {
 		fmt.Println(backend.NAME, backend.VERSION)
 		return
 	}
 
-	controller := Controller{backend.NewSearchEngine()}
+	library := backend.NewLibrary()
+	controller := Controller{library, library}
 
-	http.HandleFunc("/", mainHandler)
+	http.HandleFunc("/", controller.mainHandler)
 	http.HandleFunc("/stats", controller.statsHandler)
 	http.HandleFunc("/search", controller.queryHandler)
-	http.HandleFunc("/apsa.apsaedit", editHandler)
+	http.HandleFunc("GET /recipe/{id}", controller.recipeHandler)
+	http.HandleFunc("GET /recipe/{id}/pdf", controller.renderedRecipeHandler(backend.NewLatexRenderer(), "application/pdf"))
+	http.HandleFunc("GET /recipe/{id}/epub", controller.renderedRecipeHandler(backend.NewEpubRenderer(), "application/epub+zip"))
+	controller.registerApiHandlers()
+	controller.registerEditorHandlers()
+	controller.registerShoppingListHandlers()
 	serveDirectory("/static/", backend.Config.TemplateDirectory+"static")
 	server := http.Server{}
 
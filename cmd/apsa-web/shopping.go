@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	backend "github.com/yzhs/apsa"
+	"github.com/yzhs/apsa/units"
+)
+
+// ShoppingListPage is the data needed to render the shopping list.
+//
+// apsa-web does not keep the cart itself.  The pages add the ids of recipes,
+// optionally with the number of portions, to a list in the browser's local
+// storage and link to the shopping list with one "recipe" parameter each,
+// e.g. shopping-list?recipe=stollen:12&recipe=pfannkuchen.  The template then
+// lists the items of each section of the store:
+//
+//	{{range .List.Sections}}<h2>{{.Category}}</h2>
+//	<ul>{{range .Items}}<li>{{.}}</li>{{end}}</ul>{{end}}
+type ShoppingListPage struct {
+	// Recipes contains the recipe parameters as sent by the client, e.g.
+	// "stollen:12", so the page can link back to the same list.
+	Recipes []string
+	List    backend.ShoppingList
+	Units   units.System
+}
+
+// shoppingList builds the shopping list for the recipes given as "recipe"
+// parameters, each of which may be followed by the number of portions as in
+// "stollen:12".  The parameters usually come from the cart the browser keeps
+// in local storage.  Errors are sent to the client using writeError.
+func (c Controller) shoppingList(w http.ResponseWriter, r *http.Request,
+	writeError func(http.ResponseWriter, int, string)) (backend.ShoppingList, bool) {
+	params := r.Form["recipe"]
+	entries := make([]backend.ShoppingListEntry, len(params))
+	for i, param := range params {
+		entry, err := backend.ParseShoppingListEntry(param)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return backend.ShoppingList{}, false
+		}
+		if !c.library.RecipeExists(entry.Id) {
+			writeError(w, http.StatusNotFound, "No such recipe: "+string(entry.Id))
+			return backend.ShoppingList{}, false
+		}
+		entries[i] = entry
+	}
+
+	categories, err := backend.ReadCategories()
+	if err != nil {
+		log.Println("Error reading categories:", err)
+		writeError(w, http.StatusInternalServerError, "Could not read the store categories")
+		return backend.ShoppingList{}, false
+	}
+	list, err := backend.NewShoppingList(c.library, entries, categories)
+	if errors.Is(err, backend.ErrNoSuchRecipe) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return list, false
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return list, false
+	}
+	return list, true
+}
+
+// Serve the shopping list for the recipes in the cart.
+func (c Controller) shoppingListHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	system, ok := unitSystem(w, r)
+	if !ok {
+		return
+	}
+	list, ok := c.shoppingList(w, r, func(w http.ResponseWriter, status int, message string) {
+		http.Error(w, message, status)
+	})
+	if ok {
+		renderTemplate(w, "shopping-list", ShoppingListPage{r.Form["recipe"], list.ConvertUnits(system), system})
+	}
+}
+
+// Send the shopping list for the recipes in the cart as JSON.
+func (c Controller) apiShoppingListHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	system, err := unitsParam(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if list, ok := c.shoppingList(w, r, writeJSONError); ok {
+		writeJSON(w, http.StatusOK, list.ConvertUnits(system))
+	}
+}
+
+func (c Controller) registerShoppingListHandlers() {
+	http.HandleFunc("GET /shopping-list", c.shoppingListHandler)
+	http.HandleFunc("GET /api/v1/shopping-list", c.apiShoppingListHandler)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	backend "github.com/yzhs/apsa"
+)
+
+// TagCloudEntry is a tag together with a weight from 1 to 5 depending on how
+// many recipes have that tag.
+type TagCloudEntry struct {
+	Tag    string
+	Count  int
+	Weight int
+}
+
+func newTagCloud(tags []backend.FacetTerm) []TagCloudEntry {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	minCount, maxCount := tags[0].Count, tags[0].Count
+	for _, tag := range tags {
+		if tag.Count < minCount {
+			minCount = tag.Count
+		}
+		if tag.Count > maxCount {
+			maxCount = tag.Count
+		}
+	}
+
+	cloud := make([]TagCloudEntry, len(tags))
+	for i, tag := range tags {
+		weight := 3
+		if maxCount > minCount {
+			weight = 1 + 4*(tag.Count-minCount)/(maxCount-minCount)
+		}
+		cloud[i] = TagCloudEntry{tag.Term, tag.Count, weight}
+	}
+	return cloud
+}
+
+// MainPage is the data needed to render main.html, e.g.
+//
+//	{{range .TagCloud}}<a class="w{{.Weight}}" href="search?tag={{.Tag}}">{{.Tag}}</a> {{end}}
+type MainPage struct {
+	TagCloud []TagCloudEntry
+}
+
+// searchURL builds the URL of a search page for the given query and tag
+// filters, optionally restricted to what can be cooked with the pantry.
+func searchURL(query string, tags []string, usePantry bool) string {
+	values := url.Values{}
+	if query != "" {
+		values.Set("q", query)
+	}
+	for _, tag := range tags {
+		values.Add("tag", tag)
+	}
+	if usePantry {
+		values.Set("pantry", "1")
+	}
+	return "search?" + values.Encode()
+}
+
+// withoutTag returns all selected tags except for the given one.
+func (r Result) withoutTag(tag string) []string {
+	var tags []string
+	for _, t := range r.Tags {
+		if t != tag && t != "-"+tag {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// TagURL returns the URL of the current search restricted to recipes with
+// the given tag.
+func (r Result) TagURL(tag string) string {
+	return searchURL(r.Query, append(r.withoutTag(tag), tag), r.UsePantry)
+}
+
+// ExcludeTagURL returns the URL of the current search restricted to recipes
+// without the given tag.
+func (r Result) ExcludeTagURL(tag string) string {
+	return searchURL(r.Query, append(r.withoutTag(tag), "-"+tag), r.UsePantry)
+}
+
+// RemoveTagURL returns the URL of the current search without the given tag
+// filter, which may be negated.
+func (r Result) RemoveTagURL(tag string) string {
+	return searchURL(r.Query, r.withoutTag(strings.TrimPrefix(tag, "-")), r.UsePantry)
+}
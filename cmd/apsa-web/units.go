@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	backend "github.com/yzhs/apsa"
+	"github.com/yzhs/apsa/units"
+)
+
+// unitsCookie remembers the system of units the user chose last.
+const unitsCookie = "units"
+
+// unitsParam reads the system of units requested using the "units" parameter.
+// Without the parameter, amounts are shown as written.
+func unitsParam(r *http.Request) (units.System, error) {
+	var system units.System
+	if name := r.FormValue("units"); name != "" {
+		return system, system.Set(name)
+	}
+	return system, nil
+}
+
+// unitSystem returns the system of units requested by the client.  A choice
+// made using the "units" parameter is stored in a cookie, so it applies to
+// all pages until the user changes it.  If the parameter is invalid, an error
+// is sent to the client and false is returned.
+func unitSystem(w http.ResponseWriter, r *http.Request) (units.System, bool) {
+	if r.FormValue("units") == "" {
+		var system units.System
+		if cookie, err := r.Cookie(unitsCookie); err == nil && system.Set(cookie.Value) == nil {
+			return system, true
+		}
+		return units.Original, true
+	}
+
+	system, err := unitsParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return system, false
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     unitsCookie,
+		Value:    system.String(),
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return system, true
+}
+
+// convertUnits expresses the amounts in the recipes in the given system of
+// units.
+func convertUnits(recipes []backend.ModernistRecipe, system units.System) {
+	if system == units.Original {
+		return
+	}
+	nutrients, err := backend.ReadNutrientTable()
+	if err != nil {
+		log.Println("Error reading nutrient table:", err)
+	}
+	for i, recipe := range recipes {
+		recipes[i] = backend.ConvertUnits(recipe, system, nutrients)
+	}
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	flag "github.com/ogier/pflag"
 
 	"github.com/yzhs/apsa"
+	"github.com/yzhs/apsa/units"
 )
 
 func printStats(s apsa.SearchEngine) {
@@ -19,42 +24,440 @@ func printStats(s apsa.SearchEngine) {
 	fmt.Printf("The library contains %v recipes with a total size of %.1f kiB.\n", n, size)
 }
 
-func import_from_urls(urls []string) {
-	for _, recipeUrl := range urls {
-		if !strings.HasPrefix(recipeUrl, "http") {
-			apsa.LogError(fmt.Sprintf("Could not import recipe from '%s'. Not recognized as an HTTP URL.", recipeUrl))
+// Import recipes from web pages describing them using schema.org JSON-LD.
+// The pages can be given as local HTML files, as URLs or as "-" for stdin.
+// For web pages without JSON-LD, the apsa-import-<hostname> helper is used.
+func import_recipes(sources []string) {
+	for _, source := range sources {
+		if strings.HasPrefix(source, "http") {
+			import_from_url(source)
 			continue
 		}
 
-		u, err := url.Parse(recipeUrl)
+		var page []byte
+		var err error
+		if source == "-" {
+			page, err = io.ReadAll(os.Stdin)
+		} else {
+			page, err = os.ReadFile(source)
+		}
 		if err != nil {
-			apsa.LogError(fmt.Sprintf("Could not import recipe from '%s'. Not recognized as an HTTP URL.", recipeUrl))
+			apsa.LogError(err)
 			continue
 		}
+		import_page(source, page, "")
+	}
+}
 
-		hostname := strings.TrimPrefix(u.Hostname(), "www.")
+// Import the recipe contained in an HTML page.  If the recipe does not
+// mention where it comes from, sourceUrl is used instead.  Amounts and
+// temperatures are converted into metric units like those of the other
+// recipes.
+func import_page(source string, page []byte, sourceUrl string) error {
+	recipe, losses, err := apsa.ImportSchemaOrg(page)
+	if err != nil {
+		apsa.LogError(fmt.Sprintf("Could not import recipe from '%s': %v", source, err))
+		return err
+	}
+	for _, loss := range losses {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", source, loss)
+	}
+	recipe = convertUnits(recipe, units.Metric)
+	if recipe.Source == "" {
+		recipe.Source = sourceUrl
+	}
 
-		cmd := exec.Command("apsa-import-"+hostname, recipeUrl)
-		apsa.TryLogError(cmd.Run())
+	id, err := apsa.NewLibrary().WriteRecipe(recipe)
+	if errors.Is(err, apsa.ErrIndexNotUpdated) {
+		apsa.LogError(fmt.Sprintf("Saved recipe from '%s' as %s: %v", source, id, err))
+	} else if err != nil {
+		apsa.LogError(fmt.Sprintf("Could not save recipe from '%s': %v", source, err))
+		return err
+	}
+	fmt.Println(id)
+	return nil
+}
+
+func import_from_url(recipeUrl string) {
+	u, err := url.Parse(recipeUrl)
+	if err != nil {
+		apsa.LogError(fmt.Sprintf("Could not import recipe from '%s'. Not recognized as an HTTP URL.", recipeUrl))
+		return
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	response, err := client.Get(recipeUrl)
+	if err == nil {
+		defer response.Body.Close()
+		var page []byte
+		page, err = io.ReadAll(response.Body)
+		if err == nil && response.StatusCode == http.StatusOK {
+			if import_page(recipeUrl, page, recipeUrl) == nil {
+				return
+			}
+		}
+	}
+	apsa.TryLogError(err)
+
+	// Fall back to a helper specific to the website
+	hostname := strings.TrimPrefix(u.Hostname(), "www.")
+	cmd := exec.Command("apsa-import-"+hostname, recipeUrl)
+	apsa.TryLogError(cmd.Run())
+}
+
+// Express the amounts in the recipe in the given system of units, using the
+// densities from the nutrient table where needed.
+func convertUnits(recipe apsa.ModernistRecipe, system units.System) apsa.ModernistRecipe {
+	if system == units.Original {
+		return recipe
+	}
+	nutrients, err := apsa.ReadNutrientTable()
+	apsa.TryLogError(err)
+	return apsa.ConvertUnits(recipe, system, nutrients)
+}
+
+// Print the given recipes, scaled to the given number of portions unless
+// portions is zero.
+func showRecipes(ids []string, portions float64) {
+	backend := apsa.NewBackend()
+	for _, id := range ids {
+		recipe, err := backend.ReadRecipe(apsa.Id(id))
+		if err != nil {
+			apsa.LogError(err)
+			continue
+		}
+
+		if portions != 0 {
+			recipe, err = apsa.ScaleToPortions(recipe, portions)
+			if err != nil {
+				apsa.LogError(err)
+				continue
+			}
+		}
+
+		recipe = convertUnits(recipe, apsa.Config.Units)
+		content, err := apsa.ToYaml(recipe)
+		if err != nil {
+			apsa.LogError(err)
+			continue
+		}
+		fmt.Printf("# %s\n%s\n", recipe.Id, content)
+	}
+}
+
+// Print a shopping list for the given recipes, each of which may be followed
+// by the number of portions as in "stollen:12".  Otherwise the recipes are
+// scaled to the given number of portions unless it is zero.
+func shoppingList(args []string, portions float64) {
+	entries := make([]apsa.ShoppingListEntry, len(args))
+	for i, arg := range args {
+		entry, err := apsa.ParseShoppingListEntry(arg)
+		if err != nil {
+			apsa.LogError(err)
+			os.Exit(2)
+		}
+		if entry.Portions == 0 {
+			entry.Portions = portions
+		}
+		entries[i] = entry
+	}
+
+	categories, err := apsa.ReadCategories()
+	if err != nil {
+		apsa.LogError(err)
+		os.Exit(2)
+	}
+	list, err := apsa.NewShoppingList(apsa.NewBackend(), entries, categories)
+	if err != nil {
+		apsa.LogError(err)
+		os.Exit(1)
+	}
+	list = list.ConvertUnits(apsa.Config.Units)
+
+	for i, section := range list.Sections {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s:\n", section.Category)
+		for _, item := range section.Items {
+			fmt.Printf("  - %s\n", item)
+		}
+	}
+}
+
+// List the recipes matching the query ranked by how many of their ingredients
+// are in the pantry, together with the missing ones.
+func cookWith(args []string, pantryFile string) {
+	if pantryFile == "" {
+		pantryFile = apsa.PantryFile()
+	}
+	pantry, err := apsa.ReadPantry(pantryFile)
+	if err != nil {
+		apsa.LogError(err)
+		os.Exit(2)
+	}
+
+	query := apsa.Query{Text: strings.Join(args, " "), Pantry: pantry}
+	results, err := apsa.NewSearchEngine().SearchQuery(query)
+	if err != nil {
+		apsa.LogError(err)
+		os.Exit(2)
+	}
+	for i, recipe := range results.Recipes {
+		match := results.Pantry[i]
+		fmt.Printf("%s (%s): %d/%d\n", recipe.Title, recipe.Id, match.Covered, match.Total)
+		if len(match.Missing) > 0 {
+			missing := make([]string, len(match.Missing))
+			for j, item := range match.Missing {
+				missing[j] = item.String()
+			}
+			fmt.Printf("  fehlt: %s\n", strings.Join(missing, ", "))
+		}
+	}
+}
+
+// Check the given recipes, or the whole library, for problems.  Exits with a
+// non-zero status if any errors were found.
+func lint(args []string) {
+	ids := make([]apsa.Id, len(args))
+	for i, arg := range args {
+		ids[i] = apsa.Id(arg)
+	}
+
+	diagnostics, err := apsa.LintLibrary(apsa.NewBackend(), ids)
+	if err != nil {
+		apsa.LogError(err)
+		os.Exit(2)
+	}
+
+	for _, diagnostic := range diagnostics {
+		fmt.Println(diagnostic)
+	}
+	if len(diagnostics) > 0 {
+		apsa.LogError(fmt.Sprintf("%d errors, %d warnings",
+			diagnostics.Count(apsa.Error), diagnostics.Count(apsa.Warning)))
+	}
+	if diagnostics.HasErrors() {
+		os.Exit(1)
+	}
+}
+
+// Convert the given recipes, or all of them, to YAML or Cooklang.  Only
+// Markdown recipes can be converted to YAML.  Information that cannot be
+// carried over is reported, and the original file is kept in
+// that case even if remove is set.  Since a recipe stored in two files is an
+// id collision, keeping the original is reported as well.  In a dry run, the
+// changes are only shown as a diff against the original file.
+func convert(args []string, format string, all, dryRun, remove bool) {
+	convertRecipe := apsa.ConvertToYaml
+	listRecipes := apsa.MarkdownRecipes
+	switch format {
+	case "yaml":
+	case "cook":
+		convertRecipe = apsa.ConvertToCooklang
+		listRecipes = apsa.NewBackend().ListRecipes
+	default:
+		apsa.LogError(fmt.Sprintf("Cannot convert recipes to '%s'", format))
+		os.Exit(2)
+	}
+
+	ids := make([]apsa.Id, len(args))
+	for i, arg := range args {
+		ids[i] = apsa.Id(arg)
+	}
+	if all {
+		var err error
+		ids, err = listRecipes()
+		if err != nil {
+			apsa.LogError(err)
+			os.Exit(2)
+		}
+	} else if len(ids) == 0 {
+		apsa.LogError("No recipes given, use --all to convert the whole library")
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, id := range ids {
+		conversion, err := convertRecipe(id)
+		if all && errors.Is(err, apsa.ErrNothingToConvert) {
+			continue
+		} else if err != nil {
+			apsa.LogError(err)
+			failed = true
+			continue
+		}
+		for _, loss := range conversion.Losses {
+			fmt.Fprintf(os.Stderr, "%s%s: %s\n", id, conversion.From, loss)
+		}
+
+		if conversion.Previous != nil {
+			apsa.LogError(fmt.Sprintf("%s%s already exists, skipping %s", id, conversion.To, id))
+			failed = true
+			continue
+		}
+		removeOriginal := remove && len(conversion.Losses) == 0
+		if dryRun {
+			fmt.Printf("--- %s%s\n+++ %s%s\n%s", id, conversion.From, id, conversion.To, conversion.Diff())
+			if removeOriginal {
+				fmt.Printf("removed %s%s\n", id, conversion.From)
+			}
+			continue
+		}
+
+		if remove && !removeOriginal {
+			apsa.LogError(fmt.Sprintf("Keeping %s%s since the conversion is lossy", id, conversion.From))
+		}
+		if err := conversion.Write(removeOriginal); err != nil {
+			apsa.LogError(err)
+			failed = true
+			continue
+		}
+		if !removeOriginal {
+			apsa.LogError(fmt.Sprintf("%s is now stored in both %s%s and %s%s, remove one of them to resolve the collision",
+				id, id, conversion.From, id, conversion.To))
+		}
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
 
+// Render the given recipes, e.g. as PDF files, and print the names of the
+// resulting files.
+func renderRecipes(renderer renderer, args []string) {
+	ids := make([]apsa.Id, len(args))
+	for i, arg := range args {
+		ids[i] = apsa.Id(arg)
+	}
+
+	if err := apsa.RenderAll(renderer, ids); err != nil {
+		apsa.LogError(err)
+		os.Exit(1)
+	}
+	for _, id := range ids {
+		fmt.Println(renderer.OutputFile(id))
+	}
+}
+
+// renderer is an apsa.Renderer storing its output in a file.
+type renderer interface {
+	apsa.Renderer
+	OutputFile(id apsa.Id) string
+}
+
+// Combine all recipes matching the query into a single cookbook with a table
+// of contents and indexes.
+func exportCookbook(format, query, order, output, title string) {
+	renderer, err := apsa.NewCookbookRenderer(format)
+	if err != nil {
+		apsa.LogError(err)
+		os.Exit(2)
+	}
+
+	results, err := apsa.NewSearchEngine().SearchQuery(apsa.Query{Text: query})
+	if err != nil {
+		apsa.LogError(err)
+		os.Exit(2)
+	}
+	if len(results.Recipes) == 0 {
+		apsa.LogError("No recipes found")
+		os.Exit(1)
+	}
+	if err := apsa.SortRecipes(results.Recipes, order); err != nil {
+		apsa.LogError(err)
+		os.Exit(2)
+	}
+
+	if output == "" {
+		output = "kochbuch" + renderer.Extension()
+	}
+	book := apsa.Cookbook{Title: title, Recipes: results.Recipes}
+	if err := renderer.RenderCookbook(book, output); err != nil {
+		apsa.LogError(err)
+		os.Exit(1)
+	}
+	fmt.Println(output)
+}
+
 func main() {
-	var index, profile, stats, version bool
+	var all, dryRun, index, profile, remove, stats, version bool
+	var portions float64
+	var exportFormat, format, latex, order, output, pantry, query, title string
+	var collisions apsa.CollisionPolicy
+	var system units.System
+	flag.Var(&collisions, "collisions", "\tWhich file to use for recipes stored more than once: yaml, newest or error")
+	flag.BoolVar(&all, "all", false, "\tApply to all recipes")
+	flag.BoolVarP(&dryRun, "dry-run", "n", false, "\tOnly show what would be changed")
+	flag.StringVar(&exportFormat, "format", "pdf", "\tFormat of the exported cookbook: pdf, html or epub")
+	flag.StringVar(&latex, "latex", "", "\tLaTeX binary used to typeset recipes, e.g. pdflatex")
+	flag.StringVarP(&output, "output", "o", "", "\tFile to write the cookbook to")
+	flag.StringVar(&pantry, "pantry", "", "\tFile listing the ingredients at hand, ~/.apsa/pantry.yaml by default")
+	flag.StringVar(&query, "query", "", "\tSearch query selecting the recipes to export")
+	flag.StringVar(&order, "sort", "title", "\tOrder of the exported recipes: title, tag or a file listing one id per line")
+	flag.StringVar(&title, "title", "Kochbuch", "\tTitle of the exported cookbook")
+	flag.Var(&system, "units", "\tUnits to show amounts in: original, metric or imperial")
+	flag.BoolVar(&remove, "remove", false, "\tRemove the original files after converting them")
+	flag.StringVar(&format, "to", "yaml", "\tFormat to convert recipes to: yaml or cook")
 	flag.BoolVarP(&index, "index", "i", false, "\tUpdate the index")
+	flag.Float64VarP(&portions, "portions", "p", 0, "\tScale recipes to the given number of portions")
 	flag.BoolVarP(&stats, "stats", "S", false, "\tPrint some statistics")
 	flag.BoolVarP(&version, "version", "v", false, "\tShow version")
 	flag.BoolVar(&profile, "profile", false, "\tEnable profiler")
 	flag.Parse()
 
+	apsa.InitConfig()
+	apsa.Config.MaxResults = 1e9
+	apsa.Config.CollisionPolicy = collisions
+	apsa.Config.Units = system
+	if latex != "" {
+		apsa.Config.LatexBinary = latex
+	}
+
 	if flag.Arg(0) == "import" {
-		var args = flag.Args()[1:]
-		import_from_urls(args)
+		import_recipes(flag.Args()[1:])
 		return
 	}
 
-	apsa.InitConfig()
-	apsa.Config.MaxResults = 1e9
+	if flag.Arg(0) == "lint" {
+		lint(flag.Args()[1:])
+		return
+	}
+
+	if flag.Arg(0) == "convert" {
+		convert(flag.Args()[1:], format, all, dryRun, remove)
+		return
+	}
+
+	if flag.Arg(0) == "pdf" {
+		renderRecipes(apsa.NewLatexRenderer(), flag.Args()[1:])
+		return
+	}
+
+	if flag.Arg(0) == "epub" {
+		renderRecipes(apsa.NewEpubRenderer(), flag.Args()[1:])
+		return
+	}
+
+	if flag.Arg(0) == "export" {
+		exportCookbook(exportFormat, query, order, output, title)
+		return
+	}
+
+	if flag.Arg(0) == "cook-with" {
+		cookWith(flag.Args()[1:], pantry)
+		return
+	}
+
+	if flag.Arg(0) == "shopping-list" {
+		shoppingList(flag.Args()[1:], portions)
+		return
+	}
+
+	if flag.Arg(0) == "show" {
+		showRecipes(flag.Args()[1:], portions)
+		return
+	}
 
 	searchEngine := apsa.NewSearchEngine()
 
@@ -67,14 +470,11 @@ func main() {
 	case version:
 		fmt.Println(apsa.NAME, apsa.VERSION)
 	default:
-		i := 1
-		if len(os.Args) > 0 && os.Args[1] == "--" {
-			i += 1
-		}
-		cmd := exec.Command(
-			"firefox", "http://localhost/apsa/search?q="+
-				strings.Join(os.Args[i:], " "),
-		)
+		searchUrl := "http://localhost/apsa/search?q=" + strings.Join(flag.Args(), " ")
+		if portions != 0 {
+			searchUrl += fmt.Sprintf("&portions=%v", portions)
+		}
+		cmd := exec.Command("firefox", searchUrl)
 		apsa.TryLogError(cmd.Run())
 	}
 }
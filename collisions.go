@@ -0,0 +1,192 @@
+package apsa
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// CollisionPolicy decides which file a recipe is read from if it is stored
+// in more than one format, e.g. as both stollen.md and stollen.yaml.
+type CollisionPolicy int
+
+const (
+	// PreferYaml uses the YAML file.
+	PreferYaml CollisionPolicy = iota
+
+	// PreferNewest uses the file that was modified last.
+	PreferNewest
+
+	// RejectCollisions refuses to read the recipe at all.
+	RejectCollisions
+)
+
+var collisionPolicyNames = []string{"yaml", "newest", "error"}
+
+func (p CollisionPolicy) String() string {
+	if p < 0 || int(p) >= len(collisionPolicyNames) {
+		return ""
+	}
+	return collisionPolicyNames[p]
+}
+
+// Set parses the name of a policy, so a CollisionPolicy can be used as a
+// command line flag.
+func (p *CollisionPolicy) Set(name string) error {
+	for i, policyName := range collisionPolicyNames {
+		if name == policyName {
+			*p = CollisionPolicy(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown collision policy '%s', expected one of %s",
+		name, strings.Join(collisionPolicyNames, ", "))
+}
+
+// ErrIdCollision is returned when reading a recipe stored in more than one
+// file while the collision policy is RejectCollisions.
+var ErrIdCollision = errors.New("recipe is stored in more than one file")
+
+// recipeExtensions lists the extensions of recipe files, with the preferred
+// format first.
+var recipeExtensions = []string{".yaml", ".md", ".cook"}
+
+// recipeFile returns the name of the file the given recipe is read from
+// according to Config.CollisionPolicy.
+func recipeFile(id Id) (string, error) {
+	var files []os.FileInfo
+	for _, extension := range recipeExtensions {
+		info, err := os.Stat(Config.KnowledgeDirectory + string(id) + extension)
+		if err == nil {
+			files = append(files, info)
+		}
+	}
+
+	switch {
+	case len(files) == 0:
+		return "", fmt.Errorf("%w: %s", ErrNoSuchRecipe, id)
+	case len(files) == 1 || Config.CollisionPolicy == PreferYaml:
+		return files[0].Name(), nil
+	case Config.CollisionPolicy == RejectCollisions:
+		return "", fmt.Errorf("%w: %s", ErrIdCollision, fileNames(files))
+	}
+
+	newest := files[0]
+	for _, file := range files[1:] {
+		if file.ModTime().After(newest.ModTime()) {
+			newest = file
+		}
+	}
+	return newest.Name(), nil
+}
+
+func fileNames(files []os.FileInfo) string {
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// collisionKey maps ids that only differ in case or Unicode normalisation to
+// the same value.
+func collisionKey(id Id) string {
+	return strings.ToLower(norm.NFC.String(string(id)))
+}
+
+// findCollisions groups all recipe files whose ids collide, either because
+// they are equal or because they only differ in case or Unicode normalisation.
+// Such ids refer to the same file on some file systems.
+func findCollisions() ([][]string, error) {
+	files, err := ioutil.ReadDir(Config.KnowledgeDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]string)
+	var keys []string
+	for _, file := range files {
+		id, ok := idFromFileName(file.Name())
+		if !ok {
+			continue
+		}
+		key := collisionKey(id)
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], file.Name())
+	}
+	sort.Strings(keys)
+
+	var result [][]string
+	for _, key := range keys {
+		if len(groups[key]) > 1 {
+			result = append(result, groups[key])
+		}
+	}
+	return result, nil
+}
+
+// checkCollisions reports colliding recipe files.  If ids are given, only
+// collisions involving one of them are reported.
+func checkCollisions(ids []Id) (Diagnostics, error) {
+	groups, err := findCollisions()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[collisionKey(id)] = true
+	}
+
+	severity := Warning
+	if Config.CollisionPolicy == RejectCollisions {
+		severity = Error
+	}
+
+	var diagnostics Diagnostics
+	for _, group := range groups {
+		first, _ := idFromFileName(group[0])
+		if len(ids) > 0 && !wanted[collisionKey(first)] {
+			continue
+		}
+
+		for _, file := range group {
+			id, _ := idFromFileName(file)
+			var same, similar []string
+			for _, other := range group {
+				otherId, _ := idFromFileName(other)
+				if other == file {
+					continue
+				} else if otherId == id {
+					same = append(same, other)
+				} else {
+					similar = append(similar, other)
+				}
+			}
+
+			if len(same) > 0 {
+				used, err := recipeFile(id)
+				switch {
+				case err != nil:
+					diagnostics = append(diagnostics, Diagnostic{File: file, Severity: severity,
+						Message: "recipe is also stored in " + strings.Join(same, ", ")})
+				case used != file:
+					diagnostics = append(diagnostics, Diagnostic{File: file, Severity: severity,
+						Message: "ignored since the recipe is also stored in " + used})
+				}
+			}
+			if len(similar) > 0 {
+				diagnostics = append(diagnostics, Diagnostic{File: file, Severity: severity,
+					Message: "id only differs in case or Unicode normalisation from " + strings.Join(similar, ", ")})
+			}
+		}
+	}
+	return diagnostics, nil
+}
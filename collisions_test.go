@@ -0,0 +1,114 @@
+package apsa
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// useCollisionPolicy sets Config.CollisionPolicy for the duration of a test.
+func useCollisionPolicy(t *testing.T, policy CollisionPolicy) {
+	previous := Config.CollisionPolicy
+	Config.CollisionPolicy = policy
+	t.Cleanup(func() { Config.CollisionPolicy = previous })
+}
+
+// writeRecipeFiles creates empty recipe files, each one modified a minute
+// after the previous one.
+func writeRecipeFiles(t *testing.T, dir string, names ...string) {
+	modified := time.Now().Add(-time.Hour)
+	for _, name := range names {
+		if err := os.WriteFile(dir+name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dir+name, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		modified = modified.Add(time.Minute)
+	}
+}
+
+func TestRecipeFile(t *testing.T) {
+	dir := useLibrary(t)
+	writeRecipeFiles(t, dir, "stollen.yaml", "stollen.md", "brot.cook")
+
+	tests := []struct {
+		policy CollisionPolicy
+		id     Id
+		want   string
+		err    error
+	}{
+		{PreferYaml, "stollen", "stollen.yaml", nil},
+		{PreferNewest, "stollen", "stollen.md", nil},
+		{RejectCollisions, "stollen", "", ErrIdCollision},
+		{PreferYaml, "brot", "brot.cook", nil},
+		{RejectCollisions, "brot", "brot.cook", nil},
+		{PreferNewest, "kuchen", "", ErrNoSuchRecipe},
+	}
+	for _, test := range tests {
+		useCollisionPolicy(t, test.policy)
+		got, err := recipeFile(test.id)
+		if got != test.want || !errors.Is(err, test.err) {
+			t.Errorf("recipeFile(%q) with policy %v = %q, %v, want %q, %v",
+				test.id, test.policy, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestCheckCollisions(t *testing.T) {
+	dir := useLibrary(t)
+	nfc, nfd := norm.NFC.String("brühe"), norm.NFD.String("brühe")
+	writeRecipeFiles(t, dir, "stollen.yaml", "stollen.md", "Brot.md", "brot.yaml",
+		nfc+".md", nfd+".yaml", "kuchen.yaml")
+
+	type result struct {
+		severity Severity
+		message  string
+	}
+	collect := func(ids ...Id) map[string]result {
+		diagnostics, err := checkCollisions(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]result)
+		for _, d := range diagnostics {
+			got[d.File] = result{d.Severity, d.Message}
+		}
+		return got
+	}
+	similar := "id only differs in case or Unicode normalisation from "
+
+	useCollisionPolicy(t, PreferYaml)
+	want := map[string]result{
+		"stollen.md":  {Warning, "ignored since the recipe is also stored in stollen.yaml"},
+		"Brot.md":     {Warning, similar + "brot.yaml"},
+		"brot.yaml":   {Warning, similar + "Brot.md"},
+		nfc + ".md":   {Warning, similar + nfd + ".yaml"},
+		nfd + ".yaml": {Warning, similar + nfc + ".md"},
+	}
+	if got := collect(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	useCollisionPolicy(t, PreferNewest)
+	want = map[string]result{"stollen.yaml": {Warning, "ignored since the recipe is also stored in stollen.md"}}
+	if got := collect("stollen", "kuchen"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v for stollen and kuchen, want %v", got, want)
+	}
+
+	useCollisionPolicy(t, RejectCollisions)
+	want = map[string]result{
+		"stollen.yaml": {Error, "recipe is also stored in stollen.md"},
+		"stollen.md":   {Error, "recipe is also stored in stollen.yaml"},
+	}
+	if got := collect("Stollen"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v for Stollen, want %v", got, want)
+	}
+	if got := collect(Id(nfd)); len(got) != 2 || got[nfc+".md"].severity != Error {
+		t.Errorf("got %v for %q", got, nfd)
+	}
+}
@@ -0,0 +1,323 @@
+package apsa
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Conversion is a recipe converted from one format into another, which has
+// not been written to disk yet.
+type Conversion struct {
+	Id Id
+
+	// From and To are the extensions of the original and the new file.
+	From, To string
+
+	Content []byte
+
+	// Original is the content of the file the recipe is converted from.
+	Original []byte
+
+	// Previous is the current content of the file that will be overwritten,
+	// or nil if there is none.
+	Previous []byte
+
+	// Losses describes all information that could not be carried over.
+	Losses []string
+}
+
+func fileName(id Id, extension string) string {
+	return Config.KnowledgeDirectory + string(id) + extension
+}
+
+// MarkdownRecipes returns the ids of all recipes stored as Markdown files.
+func MarkdownRecipes() ([]Id, error) {
+	ids, err := listRecipeIds()
+	if err != nil {
+		return nil, err
+	}
+	var result []Id
+	parser := MarkdownParser{FileReaderImpl{}}
+	for _, id := range ids {
+		if parser.RecipeExists(id) {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+// ConvertToYaml converts a Markdown recipe into the YAML format.
+func ConvertToYaml(id Id) (Conversion, error) {
+	conversion := Conversion{Id: id, From: ".md", To: ".yaml"}
+
+	parser := MarkdownParser{FileReaderImpl{}}
+	doc, err := parser.readRecipe(id)
+	if err != nil {
+		return conversion, err
+	}
+	conversion.Original = []byte(doc)
+	original, _ := parser.Parse(string(id), doc)
+	recipe := FromRecipe(original)
+
+	conversion.Content, err = ToYaml(recipe)
+	if err != nil {
+		return conversion, err
+	}
+	conversion.Previous, err = os.ReadFile(fileName(id, conversion.To))
+	if err != nil && !os.IsNotExist(err) {
+		return conversion, err
+	}
+
+	conversion.Losses = append(conversion.Losses, markdownLosses(original)...)
+	conversion.Losses = append(conversion.Losses, missingLines(doc, recipe)...)
+
+	// Make sure the YAML file is read back the same way.
+	roundTrip, _ := YamlParser{}.Parse(id, conversion.Content)
+	if !reflect.DeepEqual(normalized(roundTrip), normalized(recipe)) {
+		conversion.Losses = append(conversion.Losses, "the YAML file is not read back identically")
+	}
+
+	return conversion, nil
+}
+
+// ErrNothingToConvert is returned when converting a recipe into the format it
+// is already stored in.
+var ErrNothingToConvert = errors.New("recipe is already stored in the requested format")
+
+// ConvertToCooklang converts a recipe stored in any other format into
+// Cooklang.
+func ConvertToCooklang(id Id) (Conversion, error) {
+	conversion := Conversion{Id: id, To: ".cook"}
+
+	file, err := recipeFile(id)
+	if err != nil {
+		return conversion, err
+	}
+	conversion.From = path.Ext(file)
+	if conversion.From == conversion.To {
+		return conversion, fmt.Errorf("%w: %s", ErrNothingToConvert, file)
+	}
+
+	conversion.Original, err = os.ReadFile(Config.KnowledgeDirectory + file)
+	if err != nil {
+		return conversion, err
+	}
+	recipe, err := NewBackend().ReadRecipe(id)
+	if err != nil {
+		return conversion, err
+	}
+	conversion.Content, err = ToCooklang(recipe)
+	if err != nil {
+		return conversion, err
+	}
+	conversion.Previous, err = os.ReadFile(fileName(id, conversion.To))
+	if err != nil && !os.IsNotExist(err) {
+		return conversion, err
+	}
+
+	for i, step := range recipe.Steps {
+		if paragraphBreakRegexp.MatchString(strings.TrimSpace(step.Instructions)) {
+			conversion.Losses = append(conversion.Losses,
+				fmt.Sprintf("step %d: merging the paragraphs of the instructions", i+1))
+		}
+	}
+
+	// The text of ingredients and instructions changes, but all the data
+	// should be read back the same way.
+	roundTrip, _ := CooklangParser{}.Parse(id, conversion.Content)
+	if !reflect.DeepEqual(withoutText(roundTrip), withoutText(recipe)) {
+		conversion.Losses = append(conversion.Losses, "the Cooklang file is not read back identically")
+	}
+
+	return conversion, nil
+}
+
+// withoutText only keeps the structured data of a recipe.  Since Cooklang
+// lists the ingredients of a step in the order they are mentioned in, the
+// order of the ingredients is ignored as well.
+func withoutText(recipe ModernistRecipe) ModernistRecipe {
+	recipe = normalized(recipe)
+	for i, step := range recipe.Steps {
+		ingredients := make([]Ingredient, len(step.Ingredients))
+		for j, ingredient := range step.Ingredients {
+			ingredient.Text = ""
+			ingredients[j] = ingredient
+		}
+		sort.SliceStable(ingredients, func(a, b int) bool {
+			return ingredients[a].Name < ingredients[b].Name
+		})
+		recipe.Steps[i].Ingredients = ingredients
+		recipe.Steps[i].Instructions = ""
+	}
+	return recipe
+}
+
+// normalized gets rid of differences between recipes that do not matter,
+// like empty vs. nil slices.
+func normalized(recipe ModernistRecipe) ModernistRecipe {
+	if len(recipe.Tags) == 0 {
+		recipe.Tags = nil
+	}
+	steps := make([]Step, len(recipe.Steps))
+	for i, step := range recipe.Steps {
+		if len(step.Ingredients) == 0 {
+			step.Ingredients = nil
+		}
+		step.Instructions = strings.TrimSpace(step.Instructions)
+		steps[i] = step
+	}
+	recipe.Steps = steps
+	return recipe
+}
+
+// markdownLosses lists metadata that is only approximated in the YAML format.
+func markdownLosses(recipe Recipe) []string {
+	var losses []string
+	for _, field := range []struct{ key, value string }{
+		{"Zubereitungszeit", recipe.PreparationTime},
+		{"Kochzeit", recipe.CookingTime},
+		{"Backzeit", recipe.BakingTime},
+		{"Wartezeit", recipe.WaitingTime},
+		{"Gesamtzeit", recipe.TotalTime},
+	} {
+		duration, err := ParseDuration(field.value)
+		if err != nil {
+			losses = append(losses, fmt.Sprintf("%s: dropping '%s'", field.key, field.value))
+		} else if isRange(field.value) {
+			losses = append(losses, fmt.Sprintf("%s: storing '%s' as '%v'", field.key, field.value, duration))
+		}
+	}
+	for _, field := range []struct{ key, value string }{
+		{"Umluft", recipe.FanTemp},
+		{"Ober- und Unterhitze", recipe.TopAndBottomHeatTemp},
+	} {
+		temperature, err := ParseTemperature(field.value, UnknownHeating)
+		if err != nil {
+			losses = append(losses, fmt.Sprintf("%s: dropping '%s'", field.key, field.value))
+		} else if isRange(field.value) {
+			losses = append(losses, fmt.Sprintf("%s: storing '%s' as '%s'",
+				field.key, field.value, formatNumber(temperature.Degrees)+temperature.Unit))
+		}
+	}
+	return losses
+}
+
+// isRange reports whether a value like "60 bis 70 Minuten" starts with a
+// range.
+func isRange(value string) bool {
+	amount, _ := parseAmount(strings.TrimSpace(value))
+	return amount.IsRange()
+}
+
+// missingLines finds lines of a Markdown recipe that do not appear anywhere in
+// the converted recipe.
+func missingLines(doc string, recipe ModernistRecipe) []string {
+	var parts []string
+	parts = append(parts, recipe.Title)
+	for _, step := range recipe.Steps {
+		if step.Title != nil {
+			parts = append(parts, *step.Title)
+		}
+		for _, ingredient := range step.Ingredients {
+			parts = append(parts, ingredient.Text)
+		}
+		parts = append(parts, step.Instructions)
+	}
+	content := strings.Join(parts, "\n")
+
+	var losses []string
+	for i, line := range strings.Split(doc, "\n") {
+		line = strings.TrimSpace(line)
+		key, _, isMetadata := strings.Cut(line, ":")
+		if line == "" || isMetadata && (isMarkdownMetadataKey(key) || strings.EqualFold(key, "zutaten")) {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimPrefix(line, "* "), "#"))
+		if line != "" && !strings.Contains(content, line) {
+			losses = append(losses, fmt.Sprintf("line %d: dropping '%s'", i+1, line))
+		}
+	}
+	return losses
+}
+
+// Write stores the converted recipe, removing the original file if requested,
+// and updates the index.
+func (c Conversion) Write(removeOriginal bool) error {
+	err := writeFileAtomically(fileName(c.Id, c.To), c.Content)
+	if err != nil {
+		return err
+	}
+	if removeOriginal {
+		if err := os.Remove(fileName(c.Id, c.From)); err != nil {
+			return err
+		}
+	}
+
+	recipe, err := NewBackend().ReadRecipe(c.Id)
+	if err != nil {
+		return err
+	}
+	return IndexRecipe(recipe)
+}
+
+// Diff shows the changes from the original file to the converted one in the
+// format of diff -u, without hunk headers.
+func (c Conversion) Diff() string {
+	return lineDiff(string(c.Original), string(c.Content))
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineDiff computes a minimal line based diff between two texts.
+func lineDiff(a, b string) string {
+	as := splitLines(a)
+	bs := splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of as[i:]
+	// and bs[j:].
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var result strings.Builder
+	line := func(prefix, s string) {
+		result.WriteString(prefix + s + "\n")
+	}
+	i, j := 0, 0
+	for i < len(as) || j < len(bs) {
+		switch {
+		case i < len(as) && j < len(bs) && as[i] == bs[j]:
+			line(" ", as[i])
+			i++
+			j++
+		case i < len(as) && (j == len(bs) || lcs[i+1][j] >= lcs[i][j+1]):
+			// Like diff -u, show removed lines before the added ones.
+			line("-", as[i])
+			i++
+		default:
+			line("+", bs[j])
+			j++
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,119 @@
+package apsa
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name, a, b, want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", " a\n b\n"},
+		{"empty", "", "a\n", "+a\n"},
+		{"removed", "a\nb\nc\n", "a\nc\n", " a\n-b\n c\n"},
+		{"changed", "a\nb\nc\n", "a\nx\nc\nd\n", " a\n-b\n+x\n c\n+d\n"},
+		{"no final newline", "a\nb", "a\nb\n", " a\n b\n"},
+	}
+	for _, test := range tests {
+		if got := lineDiff(test.a, test.b); got != test.want {
+			t.Errorf("%s: lineDiff(%q, %q) = %q, want %q", test.name, test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestMarkdownLosses(t *testing.T) {
+	recipe := Recipe{
+		PreparationTime:      "10 Minuten",
+		CookingTime:          "etwa eine Stunde",
+		BakingTime:           "60 bis 70 Minuten",
+		FanTemp:              "180 °C",
+		TopAndBottomHeatTemp: "200 bis 220 °C",
+	}
+	want := []string{
+		"Kochzeit: dropping 'etwa eine Stunde'",
+		"Backzeit: storing '60 bis 70 Minuten' as '" + mustParseDuration(t, "60 bis 70 Minuten").String() + "'",
+		"Ober- und Unterhitze: storing '200 bis 220 °C' as '" + mustParseTemperature(t, "200 bis 220 °C") + "'",
+	}
+	if got := markdownLosses(recipe); !reflect.DeepEqual(got, want) {
+		t.Errorf("markdownLosses = %q, want %q", got, want)
+	}
+	if got := markdownLosses(Recipe{PreparationTime: "10 Minuten"}); len(got) != 0 {
+		t.Errorf("markdownLosses without ranges = %q", got)
+	}
+}
+
+func mustParseDuration(t *testing.T, value string) Duration {
+	duration, err := ParseDuration(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return duration
+}
+
+func mustParseTemperature(t *testing.T, value string) string {
+	temperature, err := ParseTemperature(value, UnknownHeating)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return formatNumber(temperature.Degrees) + temperature.Unit
+}
+
+func TestMissingLines(t *testing.T) {
+	title := "Teig"
+	recipe := ModernistRecipe{
+		Title: "Kuchen",
+		Steps: []Step{{
+			Title:        &title,
+			Ingredients:  []Ingredient{ParseIngredient("200g Mehl")},
+			Instructions: "Alles verrühren.\n\nBacken.",
+		}},
+	}
+	doc := "# Kuchen\nTags: süß\nZutaten:\n\n## Teig\n* 200g Mehl\n* 1 Prise Salz\n\nAlles verrühren.\n\nBacken.\nGuten Appetit!\n"
+	want := []string{"line 7: dropping '1 Prise Salz'", "line 12: dropping 'Guten Appetit!'"}
+	if got := missingLines(doc, recipe); !reflect.DeepEqual(got, want) {
+		t.Errorf("missingLines = %q, want %q", got, want)
+	}
+}
+
+func TestConvertToYaml(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		losses   []string
+	}{
+		{
+			name:     "lossless",
+			markdown: "# Pfannkuchen\nZubereitungszeit: 10 Minuten\nTags: schnell\n\n* 200g Mehl\n* 2 Eier\n\nBraten.\n",
+		},
+		{
+			name:     "lossy",
+			markdown: "# Kuchen\nBackzeit: etwa eine Stunde\n\n* 200g Mehl\n\nBacken.\n",
+			losses:   []string{"Backzeit: dropping 'etwa eine Stunde'"},
+		},
+	}
+	for _, test := range tests {
+		dir := useLibrary(t)
+		if err := os.WriteFile(dir+"rezept.md", []byte(test.markdown), 0644); err != nil {
+			t.Fatal(err)
+		}
+		conversion, err := ConvertToYaml("rezept")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(conversion.Losses, test.losses) {
+			t.Errorf("%s: got losses %q, want %q", test.name, conversion.Losses, test.losses)
+		}
+		if string(conversion.Original) != test.markdown || conversion.Previous != nil {
+			t.Errorf("%s: got original %q and previous %q", test.name, conversion.Original, conversion.Previous)
+		}
+
+		markdown, _ := MarkdownParser{}.Parse("rezept", test.markdown)
+		yaml, _ := YamlParser{}.Parse("rezept", conversion.Content)
+		if want := normalized(FromRecipe(markdown)); !reflect.DeepEqual(normalized(yaml), want) {
+			t.Errorf("%s: the YAML file yields %+v, want %+v", test.name, yaml, want)
+		}
+	}
+}
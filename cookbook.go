@@ -0,0 +1,156 @@
+package apsa
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Cookbook is a collection of recipes to be rendered as a single document.
+type Cookbook struct {
+	Title   string
+	Recipes []ModernistRecipe
+}
+
+// IndexEntry is a term in the index of a cookbook together with the recipes
+// it occurs in, given as positions in Cookbook.Recipes.
+type IndexEntry struct {
+	Term    string
+	Recipes []int
+}
+
+// TagIndex lists the recipes of the cookbook by tag.
+func (b Cookbook) TagIndex() []IndexEntry {
+	return b.index(func(recipe ModernistRecipe) []string {
+		return recipe.Tags
+	})
+}
+
+// IngredientIndex lists the recipes of the cookbook by ingredient.
+func (b Cookbook) IngredientIndex() []IndexEntry {
+	return b.index(func(recipe ModernistRecipe) []string {
+		var names []string
+		for _, step := range recipe.Steps {
+			for _, ingredient := range step.Ingredients {
+				if ingredient.Name != "" {
+					names = append(names, ingredient.Name)
+				} else {
+					names = append(names, ingredient.String())
+				}
+			}
+		}
+		return names
+	})
+}
+
+// index collects the terms of all recipes, ignoring differences in case, and
+// sorts them alphabetically.
+func (b Cookbook) index(terms func(ModernistRecipe) []string) []IndexEntry {
+	entries := make(map[string]*IndexEntry)
+	for i, recipe := range b.Recipes {
+		for _, term := range terms(recipe) {
+			key := strings.ToLower(strings.TrimSpace(term))
+			if key == "" {
+				continue
+			}
+			entry, ok := entries[key]
+			if !ok {
+				entry = &IndexEntry{Term: strings.TrimSpace(term)}
+				entries[key] = entry
+			}
+			if n := len(entry.Recipes); n == 0 || entry.Recipes[n-1] != i {
+				entry.Recipes = append(entry.Recipes, i)
+			}
+		}
+	}
+
+	result := make([]IndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+	collator := newCollator()
+	sort.Slice(result, func(i, j int) bool {
+		return collator.CompareString(result[i].Term, result[j].Term) < 0
+	})
+	return result
+}
+
+// newCollator returns a collator sorting words the way a German dictionary
+// does.  Collators are not safe for concurrent use.
+func newCollator() *collate.Collator {
+	return collate.New(language.German, collate.IgnoreCase)
+}
+
+// SortRecipes orders recipes by "title", by "tag", i.e. by their first tag
+// and then by title, or in the order given by a file listing one id per line.
+// Recipes missing from the file come last, ordered by title.
+func SortRecipes(recipes []ModernistRecipe, order string) error {
+	collator := newCollator()
+	byTitle := func(a, b ModernistRecipe) bool {
+		return collator.CompareString(a.Title, b.Title) < 0
+	}
+	firstTag := func(recipe ModernistRecipe) string {
+		if len(recipe.Tags) == 0 {
+			return ""
+		}
+		return recipe.Tags[0]
+	}
+
+	switch order {
+	case "", "title":
+		sort.SliceStable(recipes, func(i, j int) bool {
+			return byTitle(recipes[i], recipes[j])
+		})
+	case "tag":
+		sort.SliceStable(recipes, func(i, j int) bool {
+			if c := collator.CompareString(firstTag(recipes[i]), firstTag(recipes[j])); c != 0 {
+				return c < 0
+			}
+			return byTitle(recipes[i], recipes[j])
+		})
+	default:
+		positions, err := readOrderFile(order)
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(recipes, func(i, j int) bool {
+			a, aListed := positions[recipes[i].Id]
+			b, bListed := positions[recipes[j].Id]
+			if aListed != bListed {
+				return aListed
+			}
+			if aListed {
+				return a < b
+			}
+			return byTitle(recipes[i], recipes[j])
+		})
+	}
+	return nil
+}
+
+// readOrderFile reads a file listing one recipe id per line.  Empty lines and
+// lines starting with '#' are ignored.
+func readOrderFile(filename string) (map[Id]int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	positions := make(map[Id]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, ok := positions[Id(line)]; !ok {
+			positions[Id(line)] = len(positions)
+		}
+	}
+	return positions, scanner.Err()
+}
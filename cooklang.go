@@ -0,0 +1,437 @@
+package apsa
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CooklangParser reads recipes written in Cooklang, see https://cooklang.org.
+type CooklangParser struct {
+	fileReader FileReader
+}
+
+// ReadRecipe reads whatever can be salvaged from a recipe file.  Problems
+// with the content are left to Lint.
+func (c CooklangParser) ReadRecipe(id Id) (ModernistRecipe, error) {
+	content, err := c.readRecipe(id)
+	if err != nil {
+		return ModernistRecipe{Id: id}, err
+	}
+	recipe, _ := c.Parse(id, content)
+	return recipe, nil
+}
+
+// Lint checks the given recipe for problems.
+func (c CooklangParser) Lint(id Id) Diagnostics {
+	content, err := c.readRecipe(id)
+	if err != nil {
+		return Diagnostics{{File: string(id) + ".cook", Severity: Error, Message: err.Error()}}
+	}
+	_, diagnostics := c.Parse(id, content)
+	return diagnostics
+}
+
+// Load the content of a given recipe from disk.
+func (c CooklangParser) readRecipe(id Id) ([]byte, error) {
+	return c.fileReader.ReadFile(Config.KnowledgeDirectory + string(id) + ".cook")
+}
+
+func (CooklangParser) RecipeExists(id Id) bool {
+	_, err := os.Stat(Config.KnowledgeDirectory + string(id) + ".cook")
+	return !os.IsNotExist(err)
+}
+
+var (
+	// Ingredients such as @Salz, @Mehl{3000%g} or @Mehl{3000%g}(Type 405)
+	// and cookware such as #Schüssel{}
+	// and timers such as ~{60%minutes} or ~Teig{1%h}
+	cooklangRegexp = regexp.MustCompile(
+		`([@#])(?:([^@#~{}\n]+?)\{([^}]*)\}|([^\s@#~{}.,;:!?()]+))(?:\(([^)]*)\))?` +
+			`|~([^@#~{}\n]*?)\{([^}]*)\}`)
+
+	cooklangCommentRegexp      = regexp.MustCompile(`(^|\s)--.*$`)
+	cooklangBlockCommentRegexp = regexp.MustCompile(`(?s)\[-.*?-\]`)
+)
+
+// Parse a Cooklang recipe.  Every paragraph is a step, the ingredients of
+// which are marked up in the text.  Sections such as "== Teig ==" become the
+// title of the step following them.
+func (CooklangParser) Parse(id Id, doc []byte) (ModernistRecipe, Diagnostics) {
+	b := newDiagnosticsBuilder(string(id)+".cook", string(doc))
+	recipe := ModernistRecipe{Id: id}
+
+	// Drop block comments, keeping the line breaks so line numbers stay
+	// correct.
+	text := cooklangBlockCommentRegexp.ReplaceAllStringFunc(string(doc), func(comment string) string {
+		return strings.Repeat("\n", strings.Count(comment, "\n"))
+	})
+	lines := strings.Split(text, "\n")
+
+	start := 0
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "---" {
+				parseCooklangFrontMatter(b, &recipe, strings.Join(lines[1:i], "\n"))
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	var stepLines []int
+	var paragraph []string
+	var title *string
+	addStep := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		step := parseCooklangStep(strings.Join(paragraph, "\n"))
+		step.Title = title
+		if strings.ContainsAny(step.Instructions, "{}") {
+			b.add(stepLines[len(stepLines)-1], Warning, "unbalanced braces in step %d", len(recipe.Steps)+1)
+		}
+		recipe.Steps = append(recipe.Steps, step)
+		paragraph, title = nil, nil
+	}
+	for i := start; i < len(lines); i++ {
+		line := strings.TrimSpace(cooklangCommentRegexp.ReplaceAllString(lines[i], ""))
+		switch {
+		case strings.HasPrefix(line, ">>"):
+			key, value, _ := strings.Cut(strings.TrimPrefix(line, ">>"), ":")
+			if err := setCooklangMetadata(&recipe, key, value); err != nil {
+				b.add(i+1, Warning, "%v", err)
+			}
+		case line == "":
+			if strings.TrimSpace(lines[i]) == "" {
+				addStep()
+			}
+		case strings.HasPrefix(line, "="):
+			addStep()
+			section := strings.TrimSpace(strings.Trim(line, "="))
+			if section != "" {
+				title = &section
+			}
+		default:
+			if len(paragraph) == 0 {
+				stepLines = append(stepLines, i+1)
+			}
+			paragraph = append(paragraph, strings.TrimSpace(strings.TrimPrefix(line, ">")))
+		}
+	}
+	addStep()
+
+	if recipe.Title == "" {
+		recipe.Title = titleFromId(id)
+	}
+
+	b.checkRecipe(recipe, b.find("title", 1), b.find("tags", 1), func(index int, _ Step) int {
+		if index < len(stepLines) {
+			return stepLines[index]
+		}
+		return 0
+	})
+	return recipe, b.diagnostics
+}
+
+// titleFromId guesses the title of a recipe without one, the way Cooklang
+// uses the file name as the title.
+func titleFromId(id Id) string {
+	title := strings.ReplaceAll(string(id), "-", " ")
+	r, size := utf8.DecodeRuneInString(title)
+	return string(unicode.ToUpper(r)) + title[size:]
+}
+
+func parseCooklangFrontMatter(b *diagnosticsBuilder, recipe *ModernistRecipe, frontMatter string) {
+	var metadata yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(frontMatter), &metadata); err != nil {
+		b.addYamlError(err)
+		return
+	}
+	for _, item := range metadata {
+		key := fmt.Sprint(item.Key)
+		var value string
+		if list, ok := item.Value.([]interface{}); ok {
+			values := make([]string, len(list))
+			for i, v := range list {
+				values[i] = fmt.Sprint(v)
+			}
+			value = strings.Join(values, ", ")
+		} else if item.Value != nil {
+			value = fmt.Sprint(item.Value)
+		}
+		if err := setCooklangMetadata(recipe, key, value); err != nil {
+			b.add(b.find(key+":", 1), Warning, "%v", err)
+		}
+	}
+}
+
+// setCooklangMetadata stores a single metadata entry in the recipe.
+func setCooklangMetadata(recipe *ModernistRecipe, key, value string) error {
+	value = strings.TrimSpace(value)
+	normalizedKey := strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(strings.TrimSpace(key)))
+
+	var duration *Duration
+	var temperature **Temperature
+	mode := UnknownHeating
+	switch normalizedKey {
+	case "title", "titel":
+		recipe.Title = value
+	case "servings", "portions", "portionen":
+		recipe.Portions = value
+	case "source", "quelle":
+		recipe.Source = value
+	case "tags":
+		recipe.Tags = parseTags(value)
+	case "prep time", "preparation time", "zubereitungszeit":
+		duration = &recipe.PreparationTime
+	case "cook time", "cooking time", "kochzeit":
+		duration = &recipe.CookingTime
+	case "baking time", "backzeit":
+		duration = &recipe.BakingTime
+	case "waiting time", "wartezeit":
+		duration = &recipe.WaitingTime
+	case "time", "total time", "duration", "gesamtzeit":
+		duration = &recipe.TotalTime
+	case "fan temp", "umluft":
+		temperature, mode = &recipe.FanTemp, FanHeating
+	case "top and bottom heat temp", "ober und unterhitze":
+		temperature, mode = &recipe.TopAndBottomHeatTemp, TopAndBottomHeating
+	default:
+		return fmt.Errorf("unknown key '%s'", strings.TrimSpace(key))
+	}
+
+	var err error
+	if duration != nil {
+		*duration, err = ParseDuration(value)
+	}
+	if temperature != nil {
+		*temperature, err = ParseTemperature(value, mode)
+		if *temperature != nil {
+			(*temperature).Mode = mode
+		}
+	}
+	return err
+}
+
+// parseCooklangStep extracts the ingredients from a paragraph and replaces
+// all markup by plain text.  Lines only listing ingredients, as written by
+// ToCooklang for ingredients not mentioned in the instructions, are not part
+// of the instructions.
+func parseCooklangStep(text string) Step {
+	var step Step
+	var instructions []string
+	for _, line := range strings.Split(text, "\n") {
+		ingredients, plain := parseCooklangLine(line)
+		step.Ingredients = append(step.Ingredients, ingredients...)
+		if len(ingredients) > 0 && strings.Trim(cooklangRegexp.ReplaceAllString(line, ""), " ,;") == "" {
+			continue
+		}
+		instructions = append(instructions, plain)
+	}
+	step.Instructions = strings.Join(instructions, "\n")
+	return step
+}
+
+func parseCooklangLine(line string) ([]Ingredient, string) {
+	var ingredients []Ingredient
+	var plain strings.Builder
+	last := 0
+	for _, match := range cooklangRegexp.FindAllStringSubmatchIndex(line, -1) {
+		group := func(i int) string {
+			if match[2*i] < 0 {
+				return ""
+			}
+			return line[match[2*i]:match[2*i+1]]
+		}
+		plain.WriteString(line[last:match[0]])
+		last = match[1]
+
+		name := strings.TrimSpace(group(2) + group(4))
+		switch group(1) {
+		case "@":
+			ingredients = append(ingredients, cooklangIngredient(name, group(3), group(5)))
+			plain.WriteString(name)
+		case "#":
+			plain.WriteString(name)
+		default:
+			quantity, unit, _ := strings.Cut(group(7), "%")
+			timer := strings.TrimSpace(strings.TrimSpace(quantity) + " " + strings.TrimSpace(unit))
+			if timer == "" {
+				timer = strings.TrimSpace(group(6))
+			}
+			plain.WriteString(timer)
+		}
+	}
+	plain.WriteString(line[last:])
+	return ingredients, plain.String()
+}
+
+// cooklangIngredient converts an ingredient such as @Mehl{3000%g}(Type 405)
+// given its parts.
+func cooklangIngredient(name, quantity, note string) Ingredient {
+	quantity, unit, _ := strings.Cut(quantity, "%")
+	quantity = strings.TrimPrefix(strings.TrimSpace(quantity), "=")
+	unit = strings.TrimSpace(unit)
+	if canonical, ok := unitNames[unit]; ok {
+		unit = canonical
+	}
+
+	ingredient := Ingredient{Name: name, Note: strings.TrimSpace(note)}
+	amount, rest := parseAmount(quantity)
+	if !amount.IsZero() && rest == "" {
+		ingredient.Amount = amount
+		ingredient.Unit = unit
+		ingredient.Text = ingredient.Format()
+		return ingredient
+	}
+
+	// Keep quantities such as "etwas" as they are.
+	ingredient.Text = strings.Join(strings.Fields(quantity+" "+unit+" "+name), " ")
+	if ingredient.Note != "" {
+		ingredient.Text += " (" + ingredient.Note + ")"
+	}
+	return ingredient
+}
+
+// ToCooklang serializes a recipe in the Cooklang format.  Ingredients are
+// marked up where the instructions mention them, the others are listed at
+// the beginning of their step.
+func ToCooklang(recipe ModernistRecipe) ([]byte, error) {
+	metadata := yaml.MapSlice{{Key: "title", Value: recipe.Title}}
+	add := func(key string, value interface{}) {
+		metadata = append(metadata, yaml.MapItem{Key: key, Value: value})
+	}
+	if recipe.Portions != "" {
+		add("servings", recipe.Portions)
+	}
+	if recipe.Source != "" {
+		add("source", recipe.Source)
+	}
+	if len(recipe.Tags) > 0 {
+		add("tags", recipe.Tags)
+	}
+	for _, field := range []struct {
+		key   string
+		value Duration
+	}{
+		{"prep time", recipe.PreparationTime},
+		{"cook time", recipe.CookingTime},
+		{"baking time", recipe.BakingTime},
+		{"waiting time", recipe.WaitingTime},
+		{"time", recipe.TotalTime},
+	} {
+		if field.value != 0 {
+			add(field.key, field.value)
+		}
+	}
+	if recipe.FanTemp != nil {
+		add("fan temp", recipe.FanTemp)
+	}
+	if recipe.TopAndBottomHeatTemp != nil {
+		add("top and bottom heat temp", recipe.TopAndBottomHeatTemp)
+	}
+
+	frontMatter, err := yaml.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var result strings.Builder
+	result.WriteString("---\n")
+	result.Write(frontMatter)
+	result.WriteString("---\n")
+	for _, step := range recipe.Steps {
+		result.WriteString("\n")
+		if step.Title != nil {
+			result.WriteString("== " + *step.Title + " ==\n\n")
+		}
+		result.WriteString(cooklangStep(step) + "\n")
+	}
+	return []byte(result.String()), nil
+}
+
+var paragraphBreakRegexp = regexp.MustCompile(`\n\s*\n`)
+
+// cooklangStep marks up the ingredients of a step in its instructions.
+// Paragraphs are merged since they would become separate steps otherwise.
+func cooklangStep(step Step) string {
+	text := paragraphBreakRegexp.ReplaceAllString(strings.TrimSpace(step.Instructions), "\n")
+
+	// Replace the ingredients by placeholders first so an ingredient does
+	// not match the markup of another one, e.g. "Zucker" in
+	// "@Vanillezucker{1%Pck.}".
+	var markup, unplaced []string
+	for _, ingredient := range step.Ingredients {
+		name := ingredient.Name
+		if name == "" {
+			name = ingredient.Text
+		}
+		if i := findWord(text, name); i >= 0 {
+			placeholder := fmt.Sprintf("\x00%d\x00", len(markup))
+			markup = append(markup, cooklangMarkup(ingredient, text[i:i+len(name)]))
+			text = text[:i] + placeholder + text[i+len(name):]
+		} else {
+			unplaced = append(unplaced, cooklangMarkup(ingredient, name))
+		}
+	}
+	for i, m := range markup {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), m, 1)
+	}
+
+	if len(unplaced) > 0 {
+		text = strings.TrimSpace(strings.Join(unplaced, ", ") + "\n" + text)
+	}
+	return text
+}
+
+// cooklangMarkup formats an ingredient, e.g. as @Mehl{3000%g}(Type 405).
+func cooklangMarkup(ingredient Ingredient, name string) string {
+	var quantity string
+	if !ingredient.Amount.IsZero() {
+		quantity = strconv.FormatFloat(ingredient.Amount.Min, 'f', -1, 64)
+		if ingredient.Amount.IsRange() {
+			quantity += "-" + strconv.FormatFloat(ingredient.Amount.Max, 'f', -1, 64)
+		}
+		if ingredient.Unit != "" {
+			quantity += "%" + ingredient.Unit
+		}
+	}
+	result := "@" + name + "{" + quantity + "}"
+	if ingredient.Note != "" {
+		result += "(" + ingredient.Note + ")"
+	}
+	return result
+}
+
+// findWord returns the index of the first occurrence of word in text that is
+// not part of a longer word, or -1 if there is none.
+func findWord(text, word string) int {
+	if word == "" {
+		return -1
+	}
+	for offset := 0; offset < len(text); {
+		i := strings.Index(text[offset:], word)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[i+len(word):])
+		if !isWordRune(before) && !isWordRune(after) {
+			return i
+		}
+		offset = i + 1
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
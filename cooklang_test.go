@@ -0,0 +1,146 @@
+package apsa
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCooklangParse(t *testing.T) {
+	doc := `---
+title: Pfannkuchen
+servings: 4
+tags: [schnell, süß]
+---
+>> Backzeit: 20 Minuten
+
+== Teig ==
+Verrühre @Mehl{200%g}(Type 405) mit @Eier{2} und einer Prise @Salz.
+-- Kommentar
+Lass den Teig ~{30%Minuten} ruhen.
+
+Brate den Teig in der #Pfanne{} mit @Butter{etwas} aus. [- Blockkommentar -]
+`
+	recipe, diagnostics := CooklangParser{}.Parse("pfannkuchen", []byte(doc))
+	if diagnostics.Count(Error) != 0 || diagnostics.Count(Warning) != 2 {
+		t.Errorf("got diagnostics %v, want warnings about Salz and Butter", diagnostics)
+	}
+	if recipe.Title != "Pfannkuchen" || recipe.Portions != "4" || len(recipe.Tags) != 2 {
+		t.Errorf("got title %q, portions %q and tags %v", recipe.Title, recipe.Portions, recipe.Tags)
+	}
+	if time.Duration(recipe.BakingTime) != 20*time.Minute {
+		t.Errorf("got baking time %v", time.Duration(recipe.BakingTime))
+	}
+	if len(recipe.Steps) != 2 {
+		t.Fatalf("got %d steps, want 2", len(recipe.Steps))
+	}
+
+	steps := []struct {
+		title        string
+		ingredients  []string
+		instructions string
+	}{
+		{
+			"Teig",
+			[]string{"200g Mehl (Type 405)", "2 Eier", "Salz"},
+			"Verrühre Mehl mit Eier und einer Prise Salz.\nLass den Teig 30 Minuten ruhen.",
+		},
+		{
+			"",
+			[]string{"etwas Butter"},
+			"Brate den Teig in der Pfanne mit Butter aus.",
+		},
+	}
+	for i, want := range steps {
+		step := recipe.Steps[i]
+		title := ""
+		if step.Title != nil {
+			title = *step.Title
+		}
+		if title != want.title {
+			t.Errorf("step %d has title %q, want %q", i+1, title, want.title)
+		}
+		if step.Instructions != want.instructions {
+			t.Errorf("step %d has instructions %q, want %q", i+1, step.Instructions, want.instructions)
+		}
+		if len(step.Ingredients) != len(want.ingredients) {
+			t.Errorf("step %d has ingredients %v, want %v", i+1, step.Ingredients, want.ingredients)
+			continue
+		}
+		for j, ingredient := range step.Ingredients {
+			if ingredient.Text != want.ingredients[j] {
+				t.Errorf("step %d: ingredient %d is %q, want %q", i+1, j+1, ingredient.Text, want.ingredients[j])
+			}
+		}
+	}
+}
+
+func TestCooklangIngredient(t *testing.T) {
+	tests := []struct {
+		markup string
+		amount Amount
+		unit   string
+		name   string
+		note   string
+	}{
+		{"@Salz", Amount{}, "", "Salz", ""},
+		{"@Mehl{3000%g}(Type 405)", Amount{3000, 3000}, "g", "Mehl", "Type 405"},
+		{"@rote Zwiebeln{2}", Amount{2, 2}, "", "rote Zwiebeln", ""},
+		{"@Zucker{2%Esslöffel}", Amount{2, 2}, "EL", "Zucker", ""},
+		{"@Hefe{=1%Würfel}", Amount{1, 1}, "Würfel", "Hefe", ""},
+		{"@Milch{1/2%l}", Amount{0.5, 0.5}, "l", "Milch", ""},
+		{"@Pfeffer{}", Amount{}, "", "Pfeffer", ""},
+	}
+	for _, test := range tests {
+		ingredients, _ := parseCooklangLine(test.markup)
+		if len(ingredients) != 1 {
+			t.Errorf("parseCooklangLine(%q) found %d ingredients", test.markup, len(ingredients))
+			continue
+		}
+		got := ingredients[0]
+		if got.Amount != test.amount || got.Unit != test.unit || got.Name != test.name || got.Note != test.note {
+			t.Errorf("parseCooklangLine(%q) = %+v, want amount %v, unit %q, name %q, note %q",
+				test.markup, got, test.amount, test.unit, test.name, test.note)
+		}
+	}
+}
+
+func TestCooklangRoundTrip(t *testing.T) {
+	title := "Teig"
+	recipe := ModernistRecipe{
+		Id:       "kuchen",
+		Title:    "Kuchen",
+		Portions: "12 Stück",
+		Tags:     []string{"süß"},
+		FanTemp:  &Temperature{Degrees: 175, Unit: "°C", Mode: FanHeating},
+		Steps: []Step{
+			{
+				Title:        &title,
+				Ingredients:  []Ingredient{ParseIngredient("200g Mehl"), ParseIngredient("100g Zucker")},
+				Instructions: "Das Mehl mit dem Zucker vermischen.",
+			},
+			{
+				Ingredients:  []Ingredient{ParseIngredient("1 Prise Salz")},
+				Instructions: "Backen.",
+			},
+		},
+	}
+	doc, err := ToCooklang(recipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, diagnostics := CooklangParser{}.Parse("kuchen", doc)
+	if len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics %v for\n%s", diagnostics, doc)
+	}
+	if got.Title != recipe.Title || got.Portions != recipe.Portions || got.FanTemp == nil || *got.FanTemp != *recipe.FanTemp {
+		t.Errorf("metadata not read back from\n%s", doc)
+	}
+	if len(got.Steps) != 2 || len(got.Steps[0].Ingredients) != 2 || len(got.Steps[1].Ingredients) != 1 {
+		t.Fatalf("steps not read back from\n%s", doc)
+	}
+	for i, step := range got.Steps {
+		if step.Instructions != recipe.Steps[i].Instructions {
+			t.Errorf("step %d has instructions %q, want %q", i+1, step.Instructions, recipe.Steps[i].Instructions)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package apsa
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic describes a problem found while parsing a recipe.
+type Diagnostic struct {
+	// File is the name of the recipe file relative to the library.
+	File string
+
+	// Line is the 1-based line number the problem was found in, or 0 if
+	// it cannot be attributed to a single line.
+	Line int
+
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v: %s", d.File, d.Line, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %v: %s", d.File, d.Severity, d.Message)
+}
+
+type Diagnostics []Diagnostic
+
+// Count returns the number of diagnostics with the given severity.
+func (ds Diagnostics) Count(severity Severity) int {
+	n := 0
+	for _, d := range ds {
+		if d.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// HasErrors reports whether any of the diagnostics is an error rather than a
+// mere warning.
+func (ds Diagnostics) HasErrors() bool {
+	return ds.Count(Error) > 0
+}
+
+// Err combines all errors into a single error value, ignoring warnings.  It
+// returns nil if there are no errors.
+func (ds Diagnostics) Err() error {
+	var errs []error
+	for _, d := range ds {
+		if d.Severity == Error {
+			errs = append(errs, errors.New(d.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// diagnosticsBuilder collects diagnostics for a single file.
+type diagnosticsBuilder struct {
+	file        string
+	lines       []string
+	diagnostics Diagnostics
+}
+
+func newDiagnosticsBuilder(file string, doc string) *diagnosticsBuilder {
+	return &diagnosticsBuilder{file: file, lines: strings.Split(doc, "\n")}
+}
+
+func (b *diagnosticsBuilder) add(line int, severity Severity, format string, args ...interface{}) {
+	b.diagnostics = append(b.diagnostics, Diagnostic{
+		File:     b.file,
+		Line:     line,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// find returns the 1-based number of the first line at or after the given
+// line that contains needle, or 0 if there is none.
+func (b *diagnosticsBuilder) find(needle string, from int) int {
+	if from < 1 {
+		from = 1
+	}
+	for i := from - 1; i < len(b.lines); i++ {
+		if strings.Contains(b.lines[i], needle) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// stepLocator returns the line a given step starts in.
+type stepLocator func(index int, step Step) int
+
+// checkRecipe performs the checks common to all recipe formats.
+func (b *diagnosticsBuilder) checkRecipe(recipe ModernistRecipe, titleLine, tagsLine int, locateStep stepLocator) {
+	if strings.TrimSpace(recipe.Title) == "" {
+		b.add(titleLine, Error, "empty title")
+	}
+
+	seen := make(map[string]bool)
+	for _, tag := range recipe.Tags {
+		key := strings.ToLower(tag)
+		if seen[key] {
+			b.add(tagsLine, Warning, "duplicate tag '%s'", tag)
+		}
+		seen[key] = true
+	}
+
+	classification := Classify(recipe)
+	for _, tag := range recipe.Tags {
+		diet, ok := dietTags[strings.ToLower(tag)]
+		if conflicts := classification.Conflicts(diet); ok && len(conflicts) > 0 {
+			b.add(tagsLine, Warning, "recipe is tagged '%s', but contains %s", tag, strings.Join(conflicts, ", "))
+		}
+	}
+
+	if len(recipe.Steps) == 0 {
+		b.add(0, Error, "recipe has no steps")
+	}
+	for i, step := range recipe.Steps {
+		line := locateStep(i, step)
+		if strings.TrimSpace(step.Instructions) == "" {
+			b.add(line, Warning, "step %d has no instructions", i+1)
+		}
+		for _, ingredient := range step.Ingredients {
+			if ingredient.Amount.IsZero() {
+				ingredientLine := b.find(ingredient.Text, line)
+				if ingredientLine == 0 {
+					ingredientLine = line
+				}
+				b.add(ingredientLine, Warning, "no amount given for ingredient '%s'", ingredient.Text)
+			}
+		}
+	}
+}
+
+var yamlErrorRegexp = regexp.MustCompile(`line (\d+): (.*)`)
+var unknownFieldRegexp = regexp.MustCompile(`^field (\S+) not found in type`)
+
+// addYamlError converts an error reported by the YAML library into
+// diagnostics.  Unknown keys and invalid values only affect a single field,
+// so they are mere warnings.  Anything else means the file cannot be read.
+func (b *diagnosticsBuilder) addYamlError(err error) {
+	messages := []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	severity := Error
+	var typeError *yaml.TypeError
+	if errors.As(err, &typeError) {
+		messages = typeError.Errors
+		severity = Warning
+	}
+
+	for _, message := range messages {
+		line := 0
+		if match := yamlErrorRegexp.FindStringSubmatch(message); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			message = match[2]
+		}
+		if match := unknownFieldRegexp.FindStringSubmatch(message); match != nil {
+			message = fmt.Sprintf("unknown key '%s'", match[1])
+		}
+		b.add(line, severity, "%s", message)
+	}
+}
+
+// LintLibrary checks the given recipes, or all recipes in the library if no
+// ids are given.
+func LintLibrary(backend Backend, ids []Id) (Diagnostics, error) {
+	diagnostics, err := checkCollisions(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		ids, err = listRecipeIds()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range ids {
+		if !backend.RecipeExists(id) {
+			diagnostics = append(diagnostics, Diagnostic{
+				File: string(id), Severity: Error, Message: "no such recipe",
+			})
+			continue
+		}
+		diagnostics = append(diagnostics, backend.Lint(id)...)
+	}
+	return diagnostics, nil
+}
@@ -0,0 +1,362 @@
+package apsa
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/russross/blackfriday"
+)
+
+// imageTypes maps the extensions of recipe images to their media types.  An
+// image belongs to the recipe with the same id, e.g. stollen.jpg to
+// stollen.yaml.
+var imageTypes = []struct{ extension, mediaType string }{
+	{".jpg", "image/jpeg"},
+	{".jpeg", "image/jpeg"},
+	{".png", "image/png"},
+	{".gif", "image/gif"},
+	{".webp", "image/webp"},
+	{".svg", "image/svg+xml"},
+}
+
+// recipeImage returns the name of the image file of a recipe and its media
+// type, or empty strings if there is none.
+func recipeImage(id Id) (string, string) {
+	for _, image := range imageTypes {
+		filename := Config.KnowledgeDirectory + string(id) + image.extension
+		if _, err := os.Stat(filename); err == nil {
+			return filename, image.mediaType
+		}
+	}
+	return "", ""
+}
+
+// EpubRenderer writes recipes as EPUB 3 files for e-readers, with one chapter
+// per recipe.
+type EpubRenderer struct {
+	backend Backend
+}
+
+func NewEpubRenderer() EpubRenderer {
+	return EpubRenderer{NewBackend()}
+}
+
+func (EpubRenderer) Extension() string {
+	return ".epub"
+}
+
+// OutputFile returns the name of the file the rendered recipe is stored in.
+func (e EpubRenderer) OutputFile(id Id) string {
+	return Config.TempDirectory + string(id) + e.Extension()
+}
+
+// Render writes a single recipe unless the EPUB file in the cache is newer
+// than both the recipe and its image.
+func (e EpubRenderer) Render(id Id) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
+	output := e.OutputFile(id)
+	upToDate, err := isUpToDate(id, output)
+	if err != nil {
+		return err
+	}
+	if image, _ := recipeImage(id); upToDate && image != "" {
+		imageTime, err := getModTime(image)
+		outputTime, _ := getModTime(output)
+		upToDate = err == nil && outputTime >= imageTime
+	}
+	if upToDate {
+		return nil
+	}
+
+	recipe, err := e.backend.ReadRecipe(id)
+	if err != nil {
+		return err
+	}
+	epub, err := writeEpub(Cookbook{Title: recipe.Title, Recipes: []ModernistRecipe{recipe}}, false)
+	if err != nil {
+		return fmt.Errorf("could not create EPUB file for %s: %w", id, err)
+	}
+	return writeFileAtomically(output, epub)
+}
+
+// RenderCookbook writes many recipes into a single EPUB file with a tag index
+// and an ingredient index.
+func (EpubRenderer) RenderCookbook(book Cookbook, output string) error {
+	epub, err := writeEpub(book, true)
+	if err != nil {
+		return fmt.Errorf("could not create the EPUB file: %w", err)
+	}
+	return writeFileAtomically(output, epub)
+}
+
+// epubItem is a file in an EPUB package other than the navigation document.
+type epubItem struct {
+	Id        string
+	Href      string
+	MediaType string
+	InSpine   bool
+	content   []byte
+}
+
+// epubPackage is the data needed to render the package document.
+type epubPackage struct {
+	Identifier string
+	Title      string
+	Creators   []string
+	Sources    []string
+	Subjects   []string
+	Modified   string
+	Items      []epubItem
+}
+
+// writeEpub creates an EPUB file containing the recipes of a cookbook.
+func writeEpub(book Cookbook, isIndex bool) ([]byte, error) {
+	document := newHtmlDocument(book, isIndex)
+	now := time.Now().UTC()
+	pkg := epubPackage{
+		Identifier: epubIdentifier(book),
+		Title:      book.Title,
+		Modified:   now.Format("2006-01-02T15:04:05Z"),
+		Items:      []epubItem{{Id: "style", Href: "style.css", MediaType: "text/css", content: []byte(epubStyle)}},
+	}
+
+	seen := make(map[string]bool)
+	addOnce := func(list *[]string, value string) {
+		key := strings.ToLower(value)
+		if value != "" && !seen[key] {
+			seen[key] = true
+			*list = append(*list, value)
+		}
+	}
+	for i := range document.Chapters {
+		chapter := &document.Chapters[i]
+		recipe := chapter.Recipe
+		if strings.HasPrefix(recipe.Source, "http://") || strings.HasPrefix(recipe.Source, "https://") {
+			addOnce(&pkg.Sources, recipe.Source)
+		} else {
+			addOnce(&pkg.Creators, recipe.Source)
+		}
+		for _, tag := range recipe.Tags {
+			addOnce(&pkg.Subjects, tag)
+		}
+
+		if filename, mediaType := recipeImage(recipe.Id); filename != "" {
+			content, err := os.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			chapter.Image = fmt.Sprintf("images/recipe-%d%s", i, filepath.Ext(filename))
+			pkg.Items = append(pkg.Items, epubItem{
+				Id: fmt.Sprintf("image-%d", i), Href: chapter.Image, MediaType: mediaType, content: content,
+			})
+		}
+
+		content, err := executeEpubTemplate("chapter", epubChapter{recipe.Title, *chapter})
+		if err != nil {
+			return nil, err
+		}
+		pkg.Items = append(pkg.Items, epubItem{
+			Id: fmt.Sprintf("recipe-%d", i), Href: fmt.Sprintf("recipe-%d.xhtml", i),
+			MediaType: "application/xhtml+xml", InSpine: true, content: content,
+		})
+	}
+
+	if len(document.Indexes) > 0 {
+		content, err := executeEpubTemplate("index", document)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Items = append(pkg.Items, epubItem{
+			Id: "index", Href: "index.xhtml", MediaType: "application/xhtml+xml", InSpine: true, content: content,
+		})
+	}
+
+	nav, err := executeEpubTemplate("nav", document)
+	if err != nil {
+		return nil, err
+	}
+	opf, err := executeEpubTemplate("package", pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []epubItem{
+		{Href: "../META-INF/container.xml", content: []byte(epubContainer)},
+		{Href: "content.opf", content: opf},
+		{Href: "nav.xhtml", content: nav},
+	}
+	return writeZip(append(files, pkg.Items...), now)
+}
+
+// writeZip creates an EPUB container holding the given files, whose names are
+// relative to the OEBPS directory.
+func writeZip(files []epubItem, modified time.Time) ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	// The mimetype file has to come first and must not be compressed.
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store, Modified: modified})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write([]byte("application/epub+zip")); err != nil {
+		return nil, err
+	}
+
+	for _, item := range files {
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name: path.Clean("OEBPS/" + item.Href), Method: zip.Deflate, Modified: modified,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(item.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// epubIdentifier derives a UUID from the recipes in a cookbook, so exporting
+// the same recipes again yields the same book on the e-reader.
+func epubIdentifier(book Cookbook) string {
+	hash := sha1.New()
+	hash.Write([]byte(book.Title))
+	for _, recipe := range book.Recipes {
+		hash.Write([]byte{0})
+		hash.Write([]byte(recipe.Id))
+	}
+	sum := hash.Sum(nil)
+	sum[6] = sum[6]&0x0f | 0x50 // Version 5
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// epubChapter is the data needed to render a recipe as an XHTML file.
+type epubChapter struct {
+	Title   string
+	Chapter htmlChapter
+}
+
+// executeEpubTemplate renders an XML file.  The XML declaration is added here
+// since html/template would escape it.
+func executeEpubTemplate(name string, data interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(xmlDeclaration)
+	err := epubTemplate.ExecuteTemplate(&buffer, name, data)
+	return buffer.Bytes(), err
+}
+
+const xmlDeclaration = `<?xml version="1.0" encoding="utf-8"?>
+`
+
+const epubContainer = xmlDeclaration + `<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>
+<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+</rootfiles>
+</container>
+`
+
+const epubStyle = `body { font-family: serif; }
+.facts, .source { font-size: small; }
+.ingredients { margin-left: 0; padding-left: 1em; }
+img.photo { max-width: 100%; }
+`
+
+// epubTemplate reuses the parts of htmlTemplate, but produces XHTML and links
+// to recipes in separate files.  Markdown is rendered without typographic
+// replacements since those produce HTML entities, which XHTML lacks.
+var epubTemplate = template.Must(template.Must(htmlTemplate.Clone()).Funcs(template.FuncMap{
+	"markdown": func(text string) template.HTML {
+		renderer := blackfriday.HtmlRenderer(blackfriday.HTML_USE_XHTML|blackfriday.HTML_SKIP_HTML, "", "")
+		return template.HTML(blackfriday.Markdown([]byte(text), renderer, 0))
+	},
+	"recipeLink": func(i int) string {
+		return fmt.Sprintf("recipe-%d.xhtml", i)
+	},
+}).Parse(`
+{{- define "head"}}<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="de" lang="de">
+<head>
+<meta charset="utf-8"/>
+<title>{{.}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+{{- end}}
+
+{{- define "chapter"}}{{template "head" .Title}}
+<body>
+{{template "recipe" .Chapter}}
+</body>
+</html>
+{{end}}
+
+{{- define "index"}}{{template "head" "Verzeichnisse"}}
+<body>
+{{- template "indexes" .}}
+</body>
+</html>
+{{end}}
+
+{{- define "nav"}}{{template "head" .Title}}
+<body>
+<nav epub:type="toc" id="toc">
+<h1>Inhalt</h1>
+<ol>
+{{- range .Chapters}}
+<li><a href="{{recipeLink .Number}}">{{.Recipe.Title}}</a></li>
+{{- end}}
+{{- if .Indexes}}
+<li><a href="index.xhtml">Verzeichnisse</a></li>
+{{- end}}
+</ol>
+</nav>
+</body>
+</html>
+{{end}}
+
+{{- define "package"}}<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid" xml:lang="de">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="uid">{{.Identifier}}</dc:identifier>
+<dc:title>{{.Title}}</dc:title>
+<dc:language>de</dc:language>
+{{- range .Creators}}
+<dc:creator>{{.}}</dc:creator>
+{{- end}}
+{{- range .Sources}}
+<dc:source>{{.}}</dc:source>
+{{- end}}
+{{- range .Subjects}}
+<dc:subject>{{.}}</dc:subject>
+{{- end}}
+<meta property="dcterms:modified">{{.Modified}}</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+{{- range .Items}}
+<item id="{{.Id}}" href="{{.Href}}" media-type="{{.MediaType}}"/>
+{{- end}}
+</manifest>
+<spine>
+{{- range .Items}}
+{{- if .InSpine}}
+<itemref idref="{{.Id}}"/>
+{{- end}}
+{{- end}}
+</spine>
+</package>
+{{end}}
+`))
@@ -8,6 +8,7 @@ require (
 	github.com/blevesearch/bleve v1.0.14
 	github.com/ogier/pflag v0.0.1
 	github.com/russross/blackfriday v1.6.0
+	golang.org/x/text v0.21.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -0,0 +1,187 @@
+package apsa
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// HtmlRenderer writes recipes as standalone HTML files that need neither
+// apsa-web nor the templates.
+type HtmlRenderer struct {
+	backend Backend
+}
+
+func NewHtmlRenderer() HtmlRenderer {
+	return HtmlRenderer{NewBackend()}
+}
+
+func (HtmlRenderer) Extension() string {
+	return ".html"
+}
+
+// OutputFile returns the name of the file the rendered recipe is stored in.
+func (h HtmlRenderer) OutputFile(id Id) string {
+	return Config.TempDirectory + string(id) + h.Extension()
+}
+
+// Render writes a single recipe unless the HTML file in the cache is newer
+// than the recipe.
+func (h HtmlRenderer) Render(id Id) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
+	output := h.OutputFile(id)
+	if upToDate, err := isUpToDate(id, output); err != nil || upToDate {
+		return err
+	}
+
+	recipe, err := h.backend.ReadRecipe(id)
+	if err != nil {
+		return err
+	}
+	return h.write(output, newHtmlDocument(Cookbook{Title: recipe.Title, Recipes: []ModernistRecipe{recipe}}, false))
+}
+
+// RenderCookbook writes many recipes into a single HTML file with a table of
+// contents, a tag index and an ingredient index.
+func (h HtmlRenderer) RenderCookbook(book Cookbook, output string) error {
+	return h.write(output, newHtmlDocument(book, true))
+}
+
+func (HtmlRenderer) write(output string, document htmlDocument) error {
+	var buffer bytes.Buffer
+	if err := htmlTemplate.Execute(&buffer, document); err != nil {
+		return err
+	}
+	return writeFileAtomically(output, buffer.Bytes())
+}
+
+// htmlDocument is the data needed to render htmlTemplate.
+type htmlDocument struct {
+	Title    string
+	Chapters []htmlChapter
+
+	// IsIndex is set for cookbooks, which get a table of contents and
+	// indexes.
+	IsIndex bool
+	Indexes []htmlIndex
+}
+
+// htmlChapter is a recipe together with its position in the document, which
+// is used in links to it, and the location of its image, if any.
+type htmlChapter struct {
+	Number int
+	Recipe ModernistRecipe
+	Image  string
+}
+
+type htmlIndex struct {
+	Title   string
+	Entries []IndexEntry
+}
+
+func newHtmlDocument(book Cookbook, isIndex bool) htmlDocument {
+	document := htmlDocument{Title: book.Title, IsIndex: isIndex}
+	for i, recipe := range book.Recipes {
+		document.Chapters = append(document.Chapters, htmlChapter{Number: i, Recipe: recipe})
+	}
+	if isIndex {
+		document.Indexes = []htmlIndex{
+			{"Stichwortverzeichnis", book.TagIndex()},
+			{"Zutatenverzeichnis", book.IngredientIndex()},
+		}
+	}
+	return document
+}
+
+// htmlTemplate renders a whole document.  The templates "contents", "recipe"
+// and "indexes" are also used for EPUB files, where recipeLink points to
+// separate files instead of anchors.
+var htmlTemplate = template.Must(template.New("html").Funcs(template.FuncMap{
+	"facts": func(recipe ModernistRecipe) string {
+		return strings.Join(recipeFacts(recipe), " · ")
+	},
+	"markdown": func(text string) template.HTML {
+		return template.HTML(blackfriday.MarkdownCommon([]byte(text)))
+	},
+	"recipeLink": func(i int) string {
+		return fmt.Sprintf("#recipe-%d", i)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="de">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: serif; max-width: 45em; margin: auto; padding: 1em; }
+article { page-break-after: always; }
+.facts, .source { font-size: small; color: #555; }
+.step { display: flex; gap: 2em; }
+.ingredients { flex: 0 0 14em; margin: 0; padding-left: 1em; }
+.index a { text-decoration: none; }
+</style>
+</head>
+<body>
+{{- if .IsIndex}}
+<h1>{{.Title}}</h1>
+{{template "contents" .}}
+{{- end}}
+{{range .Chapters}}
+{{template "recipe" .}}
+{{end}}
+{{- template "indexes" .}}
+</body>
+</html>
+{{- define "contents"}}<nav>
+<h2>Inhalt</h2>
+<ol>
+{{- range .Chapters}}
+<li><a href="{{recipeLink .Number}}">{{.Recipe.Title}}</a></li>
+{{- end}}
+</ol>
+</nav>{{end}}
+{{- define "recipe"}}<article id="recipe-{{.Number}}">
+<h2>{{.Recipe.Title}}</h2>
+{{- with .Image}}
+<img class="photo" src="{{.}}" alt=""/>
+{{- end}}
+<p class="facts">{{facts .Recipe}}</p>
+{{- range .Recipe.Steps}}
+{{- with .Title}}
+<h3>{{.}}</h3>
+{{- end}}
+<section class="step">
+<ul class="ingredients">
+{{- range .Ingredients}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+<div class="instructions">{{markdown .Instructions}}</div>
+</section>
+{{- end}}
+{{- with .Recipe.Source}}
+<p class="source">Quelle: {{.}}</p>
+{{- end}}
+</article>{{end}}
+{{- define "indexes"}}
+{{- range .Indexes}}
+{{- if .Entries}}
+<section class="index">
+<h2>{{.Title}}</h2>
+<dl>
+{{- range .Entries}}
+<dt>{{.Term}}</dt>
+{{- range .Recipes}}
+<dd><a href="{{recipeLink .}}">{{(index $.Chapters .).Recipe.Title}}</a></dd>
+{{- end}}
+{{- end}}
+</dl>
+</section>
+{{- end}}
+{{- end}}
+{{- end}}
+`))
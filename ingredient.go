@@ -0,0 +1,274 @@
+package apsa
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Amount is the quantity of an ingredient.  Ranges such as "2-3 Eier" have
+// Min < Max, single values have Min == Max.  The zero value means that no
+// amount was given.
+type Amount struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// IsZero reports whether no amount was given.
+func (a Amount) IsZero() bool {
+	return a.Min == 0 && a.Max == 0
+}
+
+// IsRange reports whether the amount is a range rather than a single value.
+func (a Amount) IsRange() bool {
+	return a.Min != a.Max
+}
+
+// Mean returns the middle of the range, or the value itself if a is no range.
+func (a Amount) Mean() float64 {
+	return (a.Min + a.Max) / 2
+}
+
+func (a Amount) String() string {
+	if a.IsZero() {
+		return ""
+	}
+	if a.IsRange() {
+		return formatNumber(a.Min) + "-" + formatNumber(a.Max)
+	}
+	return formatNumber(a.Min)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	if a.IsZero() {
+		return []byte("null"), nil
+	}
+	type amount Amount
+	return json.Marshal(amount(a))
+}
+
+// formatNumber formats a number the way it is usually written in German
+// recipes, i.e. without trailing zeros and with a decimal comma.
+func formatNumber(x float64) string {
+	if x == math.Trunc(x) {
+		return strconv.FormatFloat(x, 'f', 0, 64)
+	}
+	s := strconv.FormatFloat(x, 'f', 2, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return strings.Replace(s, ".", ",", 1)
+}
+
+// Ingredient is a single line of an ingredient list, split up into its parts.
+type Ingredient struct {
+	// Text is the ingredient as it was written in the recipe.
+	Text string `json:"text"`
+
+	Amount Amount `json:"amount"`
+	Unit   string `json:"unit"`
+	Name   string `json:"name"`
+
+	// Note contains additional remarks such as "Type 405" in
+	// "3000g Mehl (Type 405)".
+	Note string `json:"note"`
+}
+
+func (i Ingredient) String() string {
+	if i.Text == "" {
+		return i.Format()
+	}
+	return i.Text
+}
+
+// Format generates the textual representation of the ingredient from its
+// parts, ignoring Text.
+func (i Ingredient) Format() string {
+	var parts []string
+	if quantity := i.Quantity(); quantity != "" {
+		parts = append(parts, quantity)
+	}
+	if i.Name != "" {
+		parts = append(parts, i.Name)
+	}
+	if i.Note != "" {
+		parts = append(parts, "("+i.Note+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Quantity formats the amount together with the unit, e.g. "1200g" or
+// "2 EL".
+func (i Ingredient) Quantity() string {
+	if i.Amount.IsZero() {
+		return i.Unit
+	}
+	amount := i.Amount.String()
+	if i.Unit != "" {
+		if attachedUnits[i.Unit] {
+			amount += i.Unit
+		} else {
+			amount += " " + i.Unit
+		}
+	}
+	return amount
+}
+
+func (i *Ingredient) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+	*i = ParseIngredient(text)
+	return nil
+}
+
+func (i Ingredient) MarshalYAML() (interface{}, error) {
+	return i.String(), nil
+}
+
+// unitNames maps the different spellings of a unit to its canonical name.
+var unitNames = map[string]string{
+	"mg": "mg", "g": "g", "gr": "g", "gr.": "g", "Gramm": "g",
+	"kg": "kg", "Kilo": "kg", "Kilogramm": "kg",
+	"ml": "ml", "Milliliter": "ml", "cl": "cl", "dl": "dl",
+	"l": "l", "L": "l", "Liter": "l",
+
+	"EL": "EL", "El": "EL", "el": "EL", "Essl.": "EL", "Esslöffel": "EL", "Eßlöffel": "EL",
+	"TL": "TL", "Tl": "TL", "tl": "TL", "Teel.": "TL", "Teelöffel": "TL",
+	"Prise": "Prise", "Prisen": "Prise",
+	"Msp.": "Msp.", "Messerspitze": "Msp.", "Messerspitzen": "Msp.",
+	"Pck.": "Pck.", "Pkg.": "Pck.", "Päckchen": "Pck.",
+	"Bund": "Bund", "Tasse": "Tasse", "Tassen": "Tasse",
+	"Becher": "Becher", "Dose": "Dose", "Dosen": "Dose", "Glas": "Glas",
+	"Stück": "Stück", "Stk.": "Stück",
+	"Zehe": "Zehe", "Zehen": "Zehe",
+	"Scheibe": "Scheibe", "Scheiben": "Scheibe",
+	"Blatt": "Blatt", "Würfel": "Würfel",
+
+	"cup": "cup", "cups": "cup", "Cup": "cup", "Cups": "cup",
+	"oz": "oz", "ounce": "oz", "ounces": "oz",
+	"lb": "lb", "lbs": "lb", "pound": "lb", "pounds": "lb",
+	"tbsp": "tbsp", "Tbsp": "tbsp", "tablespoon": "tbsp", "tablespoons": "tbsp",
+	"tsp": "tsp", "teaspoon": "tsp", "teaspoons": "tsp",
+}
+
+// attachedUnits are written directly after the amount, as in "1200g".
+var attachedUnits = map[string]bool{
+	"mg": true, "g": true, "kg": true, "ml": true, "cl": true, "dl": true, "l": true,
+}
+
+var vulgarFractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4,
+	'⅛': 1.0 / 8,
+}
+
+const numberPattern = `(?:\d+\s+\d+/\d+|\d+/\d+|\d*[½⅓⅔¼¾⅛]|\d+(?:[.,]\d+)?)`
+
+var amountRegexp = regexp.MustCompile(
+	`^(` + numberPattern + `)(?:\s*(?:-|–|bis)\s*(` + numberPattern + `))?`)
+
+// parseNumber parses a single number as matched by numberPattern.
+func parseNumber(s string) float64 {
+	s = strings.TrimSpace(s)
+	if fields := strings.Fields(s); len(fields) == 2 {
+		// Mixed fraction such as "1 1/2"
+		return parseNumber(fields[0]) + parseNumber(fields[1])
+	}
+	if num, denom, ok := strings.Cut(s, "/"); ok {
+		n, _ := strconv.ParseFloat(num, 64)
+		d, _ := strconv.ParseFloat(denom, 64)
+		if d == 0 {
+			return 0
+		}
+		return n / d
+	}
+	for r, value := range vulgarFractions {
+		if prefix, ok := strings.CutSuffix(s, string(r)); ok {
+			whole, _ := strconv.ParseFloat(prefix, 64)
+			return whole + value
+		}
+	}
+	x, _ := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	return x
+}
+
+// parseAmount splits a leading amount off of s.
+func parseAmount(s string) (Amount, string) {
+	match := amountRegexp.FindStringSubmatch(s)
+	if match == nil {
+		return Amount{}, s
+	}
+	amount := Amount{Min: parseNumber(match[1])}
+	amount.Max = amount.Min
+	if match[2] != "" {
+		amount.Max = parseNumber(match[2])
+	}
+	return amount, strings.TrimSpace(s[len(match[0]):])
+}
+
+// parseUnit splits a leading unit off of s.
+func parseUnit(s string) (string, string) {
+	word := s
+	if i := strings.IndexFunc(s, func(r rune) bool { return r == ' ' || r == '\t' }); i >= 0 {
+		word = s[:i]
+	}
+	if unit, ok := unitNames[word]; ok {
+		return unit, strings.TrimSpace(s[len(word):])
+	}
+	return "", s
+}
+
+// ParseIngredient splits an ingredient such as "1 TL Salz" or
+// "3000g Mehl (Type 405)" into amount, unit, name and note.
+func ParseIngredient(text string) Ingredient {
+	text = strings.TrimSpace(text)
+	result := Ingredient{Text: text}
+
+	rest := text
+	var notes []string
+	for {
+		start := strings.Index(rest, "(")
+		if start < 0 {
+			break
+		}
+		end := closingParenthesis(rest, start)
+		if end < 0 {
+			break
+		}
+		notes = append(notes, strings.TrimSpace(rest[start+1:end]))
+		rest = strings.TrimSpace(rest[:start] + " " + rest[end+1:])
+	}
+
+	result.Amount, rest = parseAmount(rest)
+	if !result.Amount.IsZero() {
+		result.Unit, rest = parseUnit(rest)
+	}
+
+	if before, after, ok := strings.Cut(rest, ","); ok {
+		notes = append(notes, strings.TrimSpace(after))
+		rest = strings.TrimSpace(before)
+	}
+	result.Note = strings.Join(notes, "; ")
+	result.Name = strings.Join(strings.Fields(rest), " ")
+
+	return result
+}
+
+// closingParenthesis returns the index of the parenthesis closing the one at
+// start, or -1 if it is never closed.
+func closingParenthesis(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
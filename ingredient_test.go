@@ -0,0 +1,54 @@
+package apsa
+
+import "testing"
+
+func TestParseIngredient(t *testing.T) {
+	tests := []struct {
+		text   string
+		amount Amount
+		unit   string
+		name   string
+		note   string
+	}{
+		{"1 TL Salz", Amount{1, 1}, "TL", "Salz", ""},
+		{"3000g Mehl (Type 405)", Amount{3000, 3000}, "g", "Mehl", "Type 405"},
+		{"200g Mehl (Type 405) und Salz (fein)", Amount{200, 200}, "g", "Mehl und Salz", "Type 405; fein"},
+		{"1 Prise Salz (aus der Mühle (grob))", Amount{1, 1}, "Prise", "Salz", "aus der Mühle (grob)"},
+		{"2-3 Eier", Amount{2, 3}, "", "Eier", ""},
+		{"2 bis 3 EL Zucker", Amount{2, 3}, "EL", "Zucker", ""},
+		{"½ Zitrone", Amount{0.5, 0.5}, "", "Zitrone", ""},
+		{"1 1/2 Tassen Milch", Amount{1.5, 1.5}, "Tasse", "Milch", ""},
+		{"1,5 kg Kartoffeln, festkochend", Amount{1.5, 1.5}, "kg", "Kartoffeln", "festkochend"},
+		{"Salz", Amount{}, "", "Salz", ""},
+		{"Mehl (zum Bestäuben", Amount{}, "", "Mehl (zum Bestäuben", ""},
+		{"2 cups flour", Amount{2, 2}, "cup", "flour", ""},
+	}
+	for _, test := range tests {
+		got := ParseIngredient(test.text)
+		if got.Amount != test.amount || got.Unit != test.unit || got.Name != test.name || got.Note != test.note {
+			t.Errorf("ParseIngredient(%q) = %+v, want amount %v, unit %q, name %q, note %q",
+				test.text, got, test.amount, test.unit, test.name, test.note)
+		}
+		if got.String() != test.text {
+			t.Errorf("ParseIngredient(%q).String() = %q", test.text, got.String())
+		}
+	}
+}
+
+func TestIngredientFormat(t *testing.T) {
+	tests := []struct {
+		ingredient Ingredient
+		want       string
+	}{
+		{Ingredient{Amount: Amount{1200, 1200}, Unit: "g", Name: "Rosinen"}, "1200g Rosinen"},
+		{Ingredient{Amount: Amount{2, 2}, Unit: "EL", Name: "Zucker"}, "2 EL Zucker"},
+		{Ingredient{Amount: Amount{2, 3}, Name: "Eier"}, "2-3 Eier"},
+		{Ingredient{Amount: Amount{0.5, 0.5}, Name: "Zitrone", Note: "unbehandelt"}, "0,5 Zitrone (unbehandelt)"},
+		{Ingredient{Name: "Salz"}, "Salz"},
+	}
+	for _, test := range tests {
+		if got := test.ingredient.Format(); got != test.want {
+			t.Errorf("%+v.Format() = %q, want %q", test.ingredient, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package apsa
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// LatexRenderer typesets recipes as A5 recipe cards in PDF format, with the
+// ingredients of each step next to its instructions.
+type LatexRenderer struct {
+	backend Backend
+}
+
+func NewLatexRenderer() LatexRenderer {
+	return LatexRenderer{NewBackend()}
+}
+
+func (LatexRenderer) Extension() string {
+	return ".pdf"
+}
+
+// OutputFile returns the name of the file the rendered recipe is stored in.
+func (l LatexRenderer) OutputFile(id Id) string {
+	return Config.TempDirectory + string(id) + l.Extension()
+}
+
+// Render typesets a recipe unless the PDF in the cache is newer than the
+// recipe.
+func (l LatexRenderer) Render(id Id) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
+	output := l.OutputFile(id)
+	if upToDate, err := isUpToDate(id, output); err != nil || upToDate {
+		return err
+	}
+
+	recipe, err := l.backend.ReadRecipe(id)
+	if err != nil {
+		return err
+	}
+
+	pdf, err := typeset(ToLatex(recipe), 1)
+	if err != nil {
+		return fmt.Errorf("could not typeset %s: %w", id, err)
+	}
+	return writeFileAtomically(output, pdf)
+}
+
+// typeset runs LaTeX on a document the given number of times, which is more
+// than one for documents with cross references.
+func typeset(document string, runs int) ([]byte, error) {
+	if err := os.MkdirAll(Config.TempDirectory, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(Config.TempDirectory, ".latex-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	err = os.WriteFile(filepath.Join(dir, "document.tex"), []byte(document), 0644)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < runs; i++ {
+		cmd := exec.Command(Config.LatexBinary, "-interaction=nonstopmode", "-halt-on-error", "document.tex")
+		cmd.Dir = dir
+		if log, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("%s failed: %w\n%s", Config.LatexBinary, err, lastLines(string(log), 20))
+		}
+	}
+	return os.ReadFile(filepath.Join(dir, "document.pdf"))
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// recipeFacts lists the number of portions, times and temperatures of a
+// recipe for display.
+func recipeFacts(recipe ModernistRecipe) []string {
+	var facts []string
+	if recipe.Portions != "" {
+		facts = append(facts, "Portionen: "+recipe.Portions)
+	}
+	for _, field := range []struct {
+		label string
+		value Duration
+	}{
+		{"Zubereitung", recipe.PreparationTime},
+		{"Kochen", recipe.CookingTime},
+		{"Backen", recipe.BakingTime},
+		{"Warten", recipe.WaitingTime},
+		{"Gesamt", recipe.Duration()},
+	} {
+		if field.value != 0 {
+			facts = append(facts, field.label+": "+field.value.String())
+		}
+	}
+	for _, temperature := range []*Temperature{recipe.FanTemp, recipe.TopAndBottomHeatTemp} {
+		if temperature != nil {
+			facts = append(facts, temperature.String())
+		}
+	}
+	return facts
+}
+
+var latexReplacer = strings.NewReplacer(
+	`\`, `\textbackslash{}`, `&`, `\&`, `%`, `\%`, `$`, `\$`, `#`, `\#`,
+	`_`, `\_`, `{`, `\{`, `}`, `\}`, `~`, `\textasciitilde{}`, `^`, `\textasciicircum{}`,
+)
+
+// escapeLatex turns plain text into LaTeX code that typesets it.
+func escapeLatex(s string) string {
+	return latexReplacer.Replace(s)
+}
+
+const latexPreamble = `\documentclass[a5paper,10pt]{article}
+\usepackage{iftex}
+\ifPDFTeX
+  \usepackage[utf8]{inputenc}
+  \usepackage[T1]{fontenc}
+\fi
+\usepackage{lmodern}
+\usepackage[ngerman]{babel}
+\usepackage[margin=12mm]{geometry}
+\usepackage{array}
+\setlength{\parindent}{0pt}
+\setlength{\parskip}{0.5ex}
+`
+
+// ToLatex generates a LaTeX document for a recipe card.
+func ToLatex(recipe ModernistRecipe) string {
+	var result strings.Builder
+	result.WriteString(latexPreamble)
+	result.WriteString("\\pagestyle{empty}\n\\begin{document}\n")
+	fmt.Fprintf(&result, "{\\LARGE\\bfseries %s\\par}\n", escapeLatex(recipe.Title))
+	writeLatexRecipe(&result, recipe)
+	result.WriteString("\\end{document}\n")
+	return result.String()
+}
+
+// writeLatexRecipe typesets everything about a recipe except its title.
+func writeLatexRecipe(result *strings.Builder, recipe ModernistRecipe) {
+	result.WriteString("\\smallskip\n")
+
+	facts := recipeFacts(recipe)
+	if len(facts) > 0 {
+		escaped := make([]string, len(facts))
+		for i, fact := range facts {
+			escaped[i] = escapeLatex(fact)
+		}
+		fmt.Fprintf(result, "{\\small %s\\par}\n", strings.Join(escaped, " \\quad "))
+	}
+	result.WriteString("\\medskip\n\n")
+
+	for _, step := range recipe.Steps {
+		writeLatexStep(result, step)
+	}
+
+	if recipe.Source != "" {
+		fmt.Fprintf(result, "\\vfill{\\footnotesize Quelle: %s\\par}\n", escapeLatex(recipe.Source))
+	}
+}
+
+// writeLatexStep typesets a step with a table of its ingredients on the left
+// and the instructions on the right.
+func writeLatexStep(result *strings.Builder, step Step) {
+	if step.Title != nil {
+		fmt.Fprintf(result, "{\\large\\bfseries %s\\par}\n", escapeLatex(*step.Title))
+	}
+
+	var paragraphs []string
+	for _, paragraph := range paragraphBreakRegexp.Split(strings.TrimSpace(step.Instructions), -1) {
+		paragraphs = append(paragraphs, escapeLatex(paragraph))
+	}
+	instructions := strings.Join(paragraphs, "\n\n")
+
+	if len(step.Ingredients) == 0 {
+		fmt.Fprintf(result, "%s\n\n\\medskip\n", instructions)
+		return
+	}
+
+	result.WriteString("\\noindent\\begin{minipage}[t]{0.36\\textwidth}\n")
+	result.WriteString("\\begin{tabular}[t]{@{}>{\\raggedleft}p{1.3cm}@{\\,}>{\\raggedright\\arraybackslash}p{\\dimexpr\\linewidth-1.3cm-0.2em\\relax}@{}}\n")
+	for _, ingredient := range step.Ingredients {
+		quantity, name := ingredient.Quantity(), ingredient.Name
+		if name == "" || ingredient.Amount.IsZero() {
+			quantity, name = "", ingredient.String()
+		} else if ingredient.Note != "" {
+			name += " (" + ingredient.Note + ")"
+		}
+		fmt.Fprintf(result, "%s & %s \\\\\n", escapeLatex(quantity), escapeLatex(name))
+	}
+	result.WriteString("\\end{tabular}\n\\end{minipage}\\hfill\n")
+	fmt.Fprintf(result, "\\begin{minipage}[t]{0.6\\textwidth}\n%s\n\\end{minipage}\n\n\\medskip\n", instructions)
+}
+
+// RenderCookbook typesets many recipes as a book with a table of contents, a
+// tag index and an ingredient index.
+func (LatexRenderer) RenderCookbook(book Cookbook, output string) error {
+	pdf, err := typeset(CookbookToLatex(book), 2)
+	if err != nil {
+		return fmt.Errorf("could not typeset the cookbook: %w", err)
+	}
+	return writeFileAtomically(output, pdf)
+}
+
+// CookbookToLatex generates a LaTeX document containing many recipes.
+func CookbookToLatex(book Cookbook) string {
+	var result strings.Builder
+	result.WriteString(latexPreamble)
+	result.WriteString("\\usepackage{multicol}\n\\begin{document}\n")
+	fmt.Fprintf(&result, "\\begin{titlepage}\\centering\\vspace*{\\fill}{\\Huge\\bfseries %s\\par}\\vspace*{\\fill}\\end{titlepage}\n",
+		escapeLatex(book.Title))
+	result.WriteString("\\tableofcontents\n\\clearpage\n\n")
+
+	for i, recipe := range book.Recipes {
+		title := escapeLatex(recipe.Title)
+		fmt.Fprintf(&result, "\\section*{%s}\\addcontentsline{toc}{section}{%s}\\label{recipe-%d}\n", title, title, i)
+		writeLatexRecipe(&result, recipe)
+		result.WriteString("\\clearpage\n\n")
+	}
+
+	writeLatexIndex(&result, "Stichwortverzeichnis", book, book.TagIndex())
+	writeLatexIndex(&result, "Zutatenverzeichnis", book, book.IngredientIndex())
+	result.WriteString("\\end{document}\n")
+	return result.String()
+}
+
+func writeLatexIndex(result *strings.Builder, title string, book Cookbook, entries []IndexEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Fprintf(result, "\\section*{%s}\\addcontentsline{toc}{section}{%s}\n", title, title)
+	result.WriteString("\\begin{multicols}{2}\\small\n")
+	for _, entry := range entries {
+		fmt.Fprintf(result, "\\textbf{%s}\\par\n", escapeLatex(entry.Term))
+		for _, i := range entry.Recipes {
+			fmt.Fprintf(result, "\\hspace*{1em}%s\\dotfill\\pageref{recipe-%d}\\par\n",
+				escapeLatex(book.Recipes[i].Title), i)
+		}
+	}
+	result.WriteString("\\end{multicols}\n\\clearpage\n\n")
+}
@@ -0,0 +1,197 @@
+package apsa
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrNoSuchRecipe is returned when trying to modify a recipe that does not
+// exist.
+var ErrNoSuchRecipe = errors.New("no such recipe")
+
+// ErrNotYaml is returned by WriteRecipe when a recipe is stored as Markdown or
+// Cooklang.  Use ReplaceRecipe to store it as YAML instead.
+var ErrNotYaml = errors.New("recipe is not stored in the YAML format")
+
+var slugReplacer = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// Slugify turns a recipe title into something that can be used as an id,
+// e.g. "Apfelstrudel für Faule" becomes "apfelstrudel-fuer-faule".
+func Slugify(title string) Id {
+	title = slugReplacer.Replace(strings.ToLower(title))
+	var slug strings.Builder
+	dash := false
+	for _, r := range title {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && slug.Len() > 0 {
+				slug.WriteRune('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if slug.Len() == 0 {
+		return "rezept"
+	}
+	return Id(slug.String())
+}
+
+// checkId makes sure an id can be safely used as a file name in the library.
+func checkId(id Id) error {
+	if id == "" || strings.ContainsAny(string(id), "/\\") || strings.HasPrefix(string(id), ".") {
+		return fmt.Errorf("invalid recipe id '%s'", id)
+	}
+	return nil
+}
+
+// ValidId reports whether an id, e.g. one taken from a URL, can be safely used
+// as a file name in the library.
+func ValidId(id Id) bool {
+	return checkId(id) == nil
+}
+
+// writeFileAtomically replaces the content of a file such that readers never
+// see a partially written file.
+func writeFileAtomically(filename string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once the file was renamed
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// ListRecipes returns the ids of all recipes in the library.
+func (DefaultBackend) ListRecipes() ([]Id, error) {
+	return listRecipeIds()
+}
+
+// WriteRecipe stores a recipe in the YAML format.  If the recipe has no id
+// yet, a new one is derived from its title.  Recipes stored as Markdown or
+// Cooklang are not overwritten.
+func (b DefaultBackend) WriteRecipe(recipe ModernistRecipe) (Id, error) {
+	return b.writeRecipe(recipe, false)
+}
+
+// ReplaceRecipe stores a recipe in the YAML format like WriteRecipe, removing
+// Markdown or Cooklang files with the same id.
+func (b DefaultBackend) ReplaceRecipe(recipe ModernistRecipe) (Id, error) {
+	return b.writeRecipe(recipe, true)
+}
+
+func (b DefaultBackend) writeRecipe(recipe ModernistRecipe, replace bool) (Id, error) {
+	if diagnostics := Validate(recipe); diagnostics.HasErrors() {
+		return "", diagnostics.Err()
+	}
+
+	content, err := ToYaml(recipe)
+	if err != nil {
+		return "", err
+	}
+
+	id := recipe.Id
+	if id == "" {
+		id, err = b.reserveId(Slugify(recipe.Title))
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := checkId(id); err != nil {
+		return "", err
+	}
+	if !replace && (b.markdown.RecipeExists(id) || b.cooklang.RecipeExists(id)) {
+		return "", fmt.Errorf("%w: %s", ErrNotYaml, id)
+	}
+
+	err = writeFileAtomically(Config.KnowledgeDirectory+string(id)+".yaml", content)
+	if err != nil {
+		if recipe.Id == "" {
+			os.Remove(Config.KnowledgeDirectory + string(id) + ".yaml")
+		}
+		return "", err
+	}
+	if !replace {
+		return id, nil
+	}
+
+	for _, extension := range recipeExtensions[1:] {
+		err := os.Remove(Config.KnowledgeDirectory + string(id) + extension)
+		if err != nil && !os.IsNotExist(err) {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+// reserveId finds an id for a new recipe, appending "-2", "-3" etc. to the
+// slug if it is taken.  The YAML file is created right away, so that two
+// recipes saved at the same time cannot end up with the same id.
+func (b DefaultBackend) reserveId(slug Id) (Id, error) {
+	id := slug
+	for i := 2; ; i++ {
+		if !b.RecipeExists(id) {
+			file, err := os.OpenFile(Config.KnowledgeDirectory+string(id)+".yaml", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			if err == nil {
+				return id, file.Close()
+			}
+			if !os.IsExist(err) {
+				return "", err
+			}
+		}
+		id = slug + Id("-"+strconv.Itoa(i))
+	}
+}
+
+// DeleteRecipe removes all files belonging to a recipe.
+func (b DefaultBackend) DeleteRecipe(id Id) error {
+	if err := checkId(id); err != nil {
+		return err
+	}
+	if !b.RecipeExists(id) {
+		return fmt.Errorf("%w: %s", ErrNoSuchRecipe, id)
+	}
+
+	var errs []error
+	for _, extension := range recipeExtensions {
+		err := os.Remove(Config.KnowledgeDirectory + string(id) + extension)
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks a recipe that does not come from a file, e.g. one entered
+// by a user, for problems.
+func Validate(recipe ModernistRecipe) Diagnostics {
+	file := "new recipe"
+	if recipe.Id != "" {
+		file = string(recipe.Id) + ".yaml"
+	}
+	b := newDiagnosticsBuilder(file, "")
+	b.checkRecipe(recipe, 0, 0, func(int, Step) int { return 0 })
+	return b.diagnostics
+}
@@ -0,0 +1,74 @@
+package apsa
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// useLibrary points the configuration at an empty library in a temporary
+// directory for the duration of a test.
+func useLibrary(t *testing.T) string {
+	dir := t.TempDir() + "/"
+	previous := Config.KnowledgeDirectory
+	Config.KnowledgeDirectory = dir
+	t.Cleanup(func() { Config.KnowledgeDirectory = previous })
+	return dir
+}
+
+func TestWriteRecipe(t *testing.T) {
+	dir := useLibrary(t)
+	recipe := ModernistRecipe{
+		Id:    "kuchen",
+		Title: "Kuchen",
+		Steps: []Step{{Ingredients: []Ingredient{ParseIngredient("200g Mehl")}, Instructions: "Backen."}},
+	}
+	markdown := "# Kuchen\n\n* 200g Mehl\n\nBacken.\n"
+	if err := os.WriteFile(dir+"kuchen.md", []byte(markdown), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	library := NewBackend()
+	if _, err := library.WriteRecipe(recipe); !errors.Is(err, ErrNotYaml) {
+		t.Errorf("WriteRecipe over a Markdown recipe returned %v, want ErrNotYaml", err)
+	}
+	if _, err := os.Stat(dir + "kuchen.yaml"); !os.IsNotExist(err) {
+		t.Error("WriteRecipe created kuchen.yaml next to kuchen.md")
+	}
+
+	if _, err := library.ReplaceRecipe(recipe); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir + "kuchen.md"); !os.IsNotExist(err) {
+		t.Error("ReplaceRecipe kept kuchen.md")
+	}
+
+	recipe.Title = "Rührkuchen"
+	if _, err := library.WriteRecipe(recipe); err != nil {
+		t.Errorf("WriteRecipe over a YAML recipe: %v", err)
+	}
+	if got, err := library.ReadRecipe("kuchen"); err != nil || got.Title != recipe.Title {
+		t.Errorf("ReadRecipe after WriteRecipe = %q, %v", got.Title, err)
+	}
+
+	recipe.Id = ""
+	if id, err := library.WriteRecipe(recipe); err != nil || id != "ruehrkuchen" {
+		t.Errorf("WriteRecipe of a new recipe = %q, %v", id, err)
+	}
+	if id, err := library.WriteRecipe(recipe); err != nil || id != "ruehrkuchen-2" {
+		t.Errorf("WriteRecipe of another new recipe = %q, %v", id, err)
+	}
+}
+
+func TestValidId(t *testing.T) {
+	for _, id := range []Id{"stollen", "apfelstrudel-fuer-faule", "rezept.jsonld"} {
+		if !ValidId(id) {
+			t.Errorf("ValidId(%q) = false", id)
+		}
+	}
+	for _, id := range []Id{"", ".hidden", "../etc/passwd", "a/b", `a\b`} {
+		if ValidId(id) {
+			t.Errorf("ValidId(%q) = true", id)
+		}
+	}
+}
@@ -9,11 +9,25 @@ type MarkdownParser struct {
 	fileReader FileReader
 }
 
+// ReadRecipe reads whatever can be salvaged from a recipe file.  Problems
+// with the content are left to Lint.
 func (m MarkdownParser) ReadRecipe(id Id) (ModernistRecipe, error) {
 	content, err := m.readRecipe(id)
-	TryLogError(err)
-	recipe := m.Parse(string(id), content)
-	return FromRecipe(recipe), err
+	if err != nil {
+		return ModernistRecipe{Id: id}, err
+	}
+	recipe, _ := m.Parse(string(id), content)
+	return FromRecipe(recipe), nil
+}
+
+// Lint checks the given recipe for problems.
+func (m MarkdownParser) Lint(id Id) Diagnostics {
+	content, err := m.readRecipe(id)
+	if err != nil {
+		return Diagnostics{{File: string(id) + ".md", Severity: Error, Message: err.Error()}}
+	}
+	_, diagnostics := m.Parse(string(id), content)
+	return diagnostics
 }
 
 // Load the content of a given recipe from disk.
@@ -23,24 +37,24 @@ func (p MarkdownParser) readRecipe(id Id) (string, error) {
 }
 
 // Parse the tags in the given recipe content.
-func (MarkdownParser) Parse(id, doc string) Recipe {
+func (MarkdownParser) Parse(id, doc string) (Recipe, Diagnostics) {
 	lines := strings.Split(doc, "\n")
 	title, metadata, otherLines := extractMetadata(lines)
 
-	for len(otherLines) > 0 && (strings.TrimSpace(otherLines[0]) == "" || strings.Contains(otherLines[0], "Zutaten:")) {
-		otherLines = otherLines[1:]
-	}
-
-	ingredients, lastIngredientLine := extractIngredients(otherLines)
+	steps := extractSteps(otherLines)
 
-	instructions := ""
-	if lastIngredientLine < len(otherLines)-1 {
-		instructions = strings.Join(otherLines[lastIngredientLine+1:], "\n")
+	var ingredients []Ingredient
+	var instructions []string
+	for _, step := range steps {
+		ingredients = append(ingredients, step.Ingredients...)
+		if step.Instructions != "" {
+			instructions = append(instructions, step.Instructions)
+		}
 	}
 
-	return Recipe{
+	recipe := Recipe{
 		Id:       Id(id),
-		Content:  instructions,
+		Content:  strings.Join(instructions, "\n\n"),
 		Title:    title,
 		Portions: metadata["Portionen"],
 		Source:   metadata["Quelle"],
@@ -52,9 +66,125 @@ func (MarkdownParser) Parse(id, doc string) Recipe {
 		TotalTime:       metadata["Gesamtzeit"],
 		PreparationTime: metadata["Zubereitungszeit"],
 
-		FanTemp:              metadata["Umfluft"],
+		FanTemp:              metadata["Umluft"],
 		TopAndBottomHeatTemp: metadata["Ober- und Unterhitze"],
 		Ingredients:          ingredients,
+		Steps:                steps,
+	}
+
+	return recipe, checkMarkdown(id, doc, recipe)
+}
+
+// checkMarkdown looks for problems in a parsed Markdown recipe.
+func checkMarkdown(id, doc string, recipe Recipe) Diagnostics {
+	b := newDiagnosticsBuilder(id+".md", doc)
+	if strings.TrimSpace(doc) == "" {
+		b.add(0, Error, "empty file")
+		return b.diagnostics
+	}
+
+	for i, line := range b.lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, _, ok := strings.Cut(line, ":")
+		if !ok || len(key) > 30 || strings.HasPrefix(line, "*") || strings.HasPrefix(line, "#") {
+			// End of the metadata block
+			break
+		}
+		if !isMarkdownMetadataKey(key) && strings.ToLower(key) != "zutaten" {
+			b.add(i+2, Warning, "unknown key '%s'", key)
+		}
+	}
+
+	for _, field := range []struct{ key, value string }{
+		{"Zubereitungszeit", recipe.PreparationTime},
+		{"Kochzeit", recipe.CookingTime},
+		{"Backzeit", recipe.BakingTime},
+		{"Wartezeit", recipe.WaitingTime},
+		{"Gesamtzeit", recipe.TotalTime},
+	} {
+		if _, err := ParseDuration(field.value); err != nil {
+			b.add(b.find(field.key+":", 2), Warning, "%v", err)
+		}
+	}
+	for _, field := range []struct{ key, value string }{
+		{"Umluft", recipe.FanTemp},
+		{"Ober- und Unterhitze", recipe.TopAndBottomHeatTemp},
+	} {
+		if _, err := ParseTemperature(field.value, UnknownHeating); err != nil {
+			b.add(b.find(field.key+":", 2), Warning, "%v", err)
+		}
+	}
+
+	b.checkRecipe(FromRecipe(recipe), 1, b.find("Tags:", 2), func(_ int, step Step) int {
+		if step.Title != nil {
+			return b.find("## "+*step.Title, 2)
+		}
+		if len(step.Ingredients) > 0 {
+			return b.find(step.Ingredients[0].Text, 2)
+		}
+		firstLine, _, _ := strings.Cut(step.Instructions, "\n")
+		return b.find(firstLine, 2)
+	})
+	return b.diagnostics
+}
+
+var markdownMetadataKeys = []string{
+	"Quelle", "Tags", "Portionen",
+	"Zubereitungszeit", "Kochzeit", "Backzeit", "Wartezeit",
+	"Gesamtzeit", "Umluft", "Ober- und Unterhitze",
+}
+
+func isMarkdownMetadataKey(key string) bool {
+	for _, typ := range markdownMetadataKeys {
+		if strings.EqualFold(strings.TrimSpace(key), typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractSteps splits the body of a recipe into steps.  Every "##" heading
+// starts a new step with its own ingredients and instructions.  Anything
+// before the first heading becomes an untitled step.
+func extractSteps(lines []string) []Step {
+	var steps []Step
+	var title *string
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "##") {
+			continue
+		}
+
+		step := extractStep(lines[start:i])
+		step.Title = title
+		if title != nil || len(step.Ingredients) > 0 || step.Instructions != "" {
+			steps = append(steps, step)
+		}
+
+		if i < len(lines) {
+			heading := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(lines[i]), "#"))
+			heading = strings.TrimSuffix(heading, ":")
+			title = &heading
+			start = i + 1
+		}
+	}
+	return steps
+}
+
+// extractStep reads the ingredient list and instructions of a single step.
+func extractStep(lines []string) Step {
+	for len(lines) > 0 && (strings.TrimSpace(lines[0]) == "" || strings.Contains(lines[0], "Zutaten:")) {
+		lines = lines[1:]
+	}
+
+	ingredients, lastIngredientLine := extractIngredients(lines)
+
+	return Step{
+		Ingredients:  ingredients,
+		Instructions: strings.TrimSpace(strings.Join(lines[lastIngredientLine+1:], "\n")),
 	}
 }
 
@@ -73,12 +203,7 @@ func extractMetadata(lines []string) (string, map[string]string, []string) {
 			if prefix == "zutaten" && remainder == "" {
 				continue
 			}
-			metadataTypes := []string{
-				"Quelle", "Tags", "Portionen",
-				"Zubereitungszeit", "Kochzeit", "Backzeit", "Wartezeit",
-				"Gesamtzeit", "Umluft", "Ober- und Unterhitze",
-			}
-			for _, typ := range metadataTypes {
+			for _, typ := range markdownMetadataKeys {
 				if prefix == strings.ToLower(typ) {
 					containsMetadata = true
 					data[typ] += remainder
@@ -93,18 +218,13 @@ func extractMetadata(lines []string) (string, map[string]string, []string) {
 	return title, data, otherLines
 }
 
-func extractIngredients(otherLines []string) ([]string, int) {
-	ingredients := make([]string, 0, 10)
-	lastIngredientLine := 0
-	for i, line_ := range otherLines {
+func extractIngredients(lines []string) ([]Ingredient, int) {
+	ingredients := make([]Ingredient, 0, 10)
+	lastIngredientLine := -1
+	for i, line_ := range lines {
 		line := strings.TrimSpace(line_)
-		if strings.HasPrefix(line, "##") {
-			// Multipart recipes are not handled properly at the moment
-			return make([]string, 0), -1
-		}
-
 		if strings.HasPrefix(line, "* ") {
-			ingredients = append(ingredients, line[2:])
+			ingredients = append(ingredients, ParseIngredient(line[2:]))
 			lastIngredientLine = i
 		}
 	}
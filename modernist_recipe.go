@@ -2,7 +2,10 @@ package apsa
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"path"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -10,34 +13,78 @@ import (
 // ModernistRecipe describes a recipe with Modernist Cuisine-style steps grouped
 // together with ingredients needed for that step.
 type ModernistRecipe struct {
-	Id       Id
-	Title    string   `yaml:"title"`
-	Portions string   `yaml:"portions"`
-	Source   string   `yaml:"source"`
-	Tags     []string `yaml:"tags"`
-	Steps    []Step   `yaml:"steps"`
+	Id       Id       `yaml:"-" json:"id"`
+	Title    string   `yaml:"title" json:"title"`
+	Portions string   `yaml:"portions,omitempty" json:"portions"`
+	Source   string   `yaml:"source,omitempty" json:"source"`
+	Tags     []string `yaml:"tags,omitempty" json:"tags"`
+
+	// Times are serialized as minutes in JSON
+	PreparationTime Duration `yaml:"preparation_time,omitempty" json:"preparation_time,omitempty"`
+	CookingTime     Duration `yaml:"cooking_time,omitempty" json:"cooking_time,omitempty"`
+	BakingTime      Duration `yaml:"baking_time,omitempty" json:"baking_time,omitempty"`
+	WaitingTime     Duration `yaml:"waiting_time,omitempty" json:"waiting_time,omitempty"`
+	TotalTime       Duration `yaml:"total_time,omitempty" json:"total_time,omitempty"`
+
+	FanTemp              *Temperature `yaml:"fan_temp,omitempty" json:"fan_temp,omitempty"`
+	TopAndBottomHeatTemp *Temperature `yaml:"top_and_bottom_heat_temp,omitempty" json:"top_and_bottom_heat_temp,omitempty"`
+
+	Steps []Step `yaml:"steps" json:"steps"`
+}
+
+// Duration returns the total time needed to make the recipe.  If no total time
+// was given explicitly, it is the sum of the individual times.
+func (r ModernistRecipe) Duration() Duration {
+	if r.TotalTime != 0 {
+		return r.TotalTime
+	}
+	return r.PreparationTime + r.CookingTime + r.BakingTime + r.WaitingTime
 }
 
 // Step consisting of ingredients
 type Step struct {
-	Title        *string  `yaml:"title"`
-	Ingredients  []string `yaml:"ingredients"`
-	Instructions string   `yaml:"instructions"`
+	Title        *string      `yaml:"title,omitempty" json:"title,omitempty"`
+	Ingredients  []Ingredient `yaml:"ingredients,omitempty" json:"ingredients"`
+	Instructions string       `yaml:"instructions" json:"instructions"`
 }
 
 func FromRecipe(recipe Recipe) ModernistRecipe {
+	steps := recipe.Steps
+	if len(steps) == 0 {
+		steps = []Step{
+			{
+				Ingredients:  recipe.Ingredients,
+				Instructions: recipe.Content,
+			},
+		}
+	}
+
+	// Invalid values are reported by MarkdownParser.Parse.
+	preparationTime, _ := ParseDuration(recipe.PreparationTime)
+	cookingTime, _ := ParseDuration(recipe.CookingTime)
+	bakingTime, _ := ParseDuration(recipe.BakingTime)
+	waitingTime, _ := ParseDuration(recipe.WaitingTime)
+	totalTime, _ := ParseDuration(recipe.TotalTime)
+	fanTemp, _ := ParseTemperature(recipe.FanTemp, FanHeating)
+	topAndBottomHeatTemp, _ := ParseTemperature(recipe.TopAndBottomHeatTemp, TopAndBottomHeating)
+
 	return ModernistRecipe{
 		Id:       recipe.Id,
 		Title:    recipe.Title,
 		Portions: recipe.Portions,
 		Source:   recipe.Source,
 		Tags:     recipe.Tags,
-		Steps: []Step{
-			{
-				Ingredients:  recipe.Ingredients,
-				Instructions: recipe.Content,
-			},
-		},
+
+		PreparationTime: preparationTime,
+		CookingTime:     cookingTime,
+		BakingTime:      bakingTime,
+		WaitingTime:     waitingTime,
+		TotalTime:       totalTime,
+
+		FanTemp:              fanTemp,
+		TopAndBottomHeatTemp: topAndBottomHeatTemp,
+
+		Steps: steps,
 	}
 }
 
@@ -45,23 +92,111 @@ type YamlParser struct {
 	fileReader FileReader
 }
 
+// ReadRecipe reads whatever can be salvaged from a recipe file.  Problems
+// with the content are left to Lint unless the file is not valid YAML at all.
 func (y YamlParser) ReadRecipe(id Id) (ModernistRecipe, error) {
 	content, err := y.readRecipe(id)
-	TryLogError(err)
-	recipe := y.Parse(id, content)
+	if err != nil {
+		return ModernistRecipe{Id: id}, err
+	}
+	recipe, _, err := y.parse(id, content)
 	return recipe, err
 }
 
+// Lint checks the given recipe for problems.
+func (y YamlParser) Lint(id Id) Diagnostics {
+	content, err := y.readRecipe(id)
+	if err != nil {
+		return Diagnostics{{File: string(id) + ".yaml", Severity: Error, Message: err.Error()}}
+	}
+	_, diagnostics := y.Parse(id, content)
+	return diagnostics
+}
+
 // Load the content of a given recipe from disk.
 func (y YamlParser) readRecipe(id Id) ([]byte, error) {
 	return y.fileReader.ReadFile(Config.KnowledgeDirectory + string(id) + ".yaml")
 }
 
-func (YamlParser) Parse(id Id, doc []byte) ModernistRecipe {
+func (y YamlParser) Parse(id Id, doc []byte) (ModernistRecipe, Diagnostics) {
+	recipe, diagnostics, _ := y.parse(id, doc)
+	return recipe, diagnostics
+}
+
+// parse is like Parse, but also returns an error if nothing could be read.
+func (YamlParser) parse(id Id, doc []byte) (ModernistRecipe, Diagnostics, error) {
+	b := newDiagnosticsBuilder(string(id)+".yaml", string(doc))
+
 	var recipe ModernistRecipe
-	yaml.Unmarshal(doc, &recipe)
+	var unreadable error
+	if err := yaml.UnmarshalStrict(doc, &recipe); err != nil {
+		b.addYamlError(err)
+
+		// Salvage whatever can be read.  Invalid values such as a
+		// misspelt time only affect their own field, the rest of the
+		// recipe is decoded anyway.
+		recipe = ModernistRecipe{}
+		err := yaml.Unmarshal(doc, &recipe)
+		var typeError *yaml.TypeError
+		if err != nil && !errors.As(err, &typeError) {
+			recipe = ModernistRecipe{}
+			unreadable = fmt.Errorf("%s.yaml: %w", id, err)
+		}
+	}
 	recipe.Id = id
-	return recipe
+	if recipe.FanTemp != nil {
+		recipe.FanTemp.Mode = FanHeating
+	}
+	if recipe.TopAndBottomHeatTemp != nil {
+		recipe.TopAndBottomHeatTemp.Mode = TopAndBottomHeating
+	}
+
+	if unreadable == nil {
+		b.checkRecipe(recipe, b.find("title:", 1), b.find("tags:", 1), yamlStepLocator(b))
+	}
+
+	return recipe, b.diagnostics, unreadable
+}
+
+// yamlStepLocator finds the start of each step by looking for the list items
+// in the steps section.
+func yamlStepLocator(b *diagnosticsBuilder) stepLocator {
+	var stepLines []int
+	inSteps := false
+	indentation := -1
+	for i, line := range b.lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if !inSteps {
+			inSteps = strings.HasPrefix(line, "steps:")
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent == 0 && !strings.HasPrefix(trimmed, "-") {
+			// Next top-level key
+			break
+		}
+		if indentation == -1 && strings.HasPrefix(trimmed, "-") {
+			indentation = indent
+		}
+		if indent == indentation && strings.HasPrefix(trimmed, "-") {
+			stepLines = append(stepLines, i+1)
+		}
+	}
+
+	return func(index int, _ Step) int {
+		if index < len(stepLines) {
+			return stepLines[index]
+		}
+		return 0
+	}
+}
+
+// ToYaml serializes the recipe in the format understood by YamlParser.
+func ToYaml(recipe ModernistRecipe) ([]byte, error) {
+	return yaml.Marshal(recipe)
 }
 
 func (YamlParser) RecipeExists(id Id) bool {
@@ -72,24 +207,42 @@ func (YamlParser) RecipeExists(id Id) bool {
 type DefaultBackend struct {
 	markdown MarkdownParser
 	yaml     YamlParser
+	cooklang CooklangParser
 }
 
 func (b DefaultBackend) RecipeExists(id Id) bool {
-	return b.yaml.RecipeExists(id) || b.markdown.RecipeExists(id)
+	return ValidId(id) &&
+		(b.yaml.RecipeExists(id) || b.markdown.RecipeExists(id) || b.cooklang.RecipeExists(id))
 }
 
-func (b DefaultBackend) ReadRecipe(id Id) (ModernistRecipe, error) {
-	filePath := Config.KnowledgeDirectory + string(id) + ".yaml"
-
-	if _, err := os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
-		recipe, err := b.yaml.ReadRecipe(id)
-		return recipe, err
+// Lint checks all files belonging to the given recipe.
+func (b DefaultBackend) Lint(id Id) Diagnostics {
+	var diagnostics Diagnostics
+	if b.yaml.RecipeExists(id) {
+		diagnostics = append(diagnostics, b.yaml.Lint(id)...)
 	}
+	if b.markdown.RecipeExists(id) {
+		diagnostics = append(diagnostics, b.markdown.Lint(id)...)
+	}
+	if b.cooklang.RecipeExists(id) {
+		diagnostics = append(diagnostics, b.cooklang.Lint(id)...)
+	}
+	return diagnostics
+}
 
-	filePath = Config.KnowledgeDirectory + string(id) + ".md"
-	if _, err := os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
+// ReadRecipe reads a recipe from the file chosen by Config.CollisionPolicy.
+func (b DefaultBackend) ReadRecipe(id Id) (ModernistRecipe, error) {
+	file, err := recipeFile(id)
+	if err != nil {
 		return ModernistRecipe{}, err
 	}
 
-	return b.markdown.ReadRecipe(id)
+	switch path.Ext(file) {
+	case ".md":
+		return b.markdown.ReadRecipe(id)
+	case ".cook":
+		return b.cooklang.ReadRecipe(id)
+	default:
+		return b.yaml.ReadRecipe(id)
+	}
 }
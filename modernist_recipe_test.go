@@ -0,0 +1,93 @@
+package apsa
+
+import (
+	"os"
+	"testing"
+)
+
+// testRecipe returns a recipe with a single step using the given
+// ingredients.  The id doubles as the title.
+func testRecipe(id Id, ingredients ...string) ModernistRecipe {
+	step := Step{}
+	for _, ingredient := range ingredients {
+		step.Ingredients = append(step.Ingredients, ParseIngredient(ingredient))
+	}
+	return ModernistRecipe{Id: id, Title: string(id), Steps: []Step{step}}
+}
+
+// fakeFileReader serves file contents from memory, ignoring the directory.
+type fakeFileReader map[string]string
+
+func (f fakeFileReader) ReadFile(filename string) ([]byte, error) {
+	for name, content := range f {
+		if len(filename) >= len(name) && filename[len(filename)-len(name):] == name {
+			return []byte(content), nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func TestYamlReadRecipe(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		title    string
+		steps    int
+		warnings int
+		errors   int
+		fails    bool
+	}{
+		{
+			name:    "valid",
+			content: "title: Kuchen\nsteps:\n- ingredients:\n  - 200g Mehl\n  instructions: Backen.\n",
+			title:   "Kuchen", steps: 1,
+		},
+		{
+			name:    "unknown key",
+			content: "title: Kuchen\nnotes: lecker\nsteps:\n- ingredients:\n  - 200g Mehl\n  instructions: Backen.\n",
+			title:   "Kuchen", steps: 1, warnings: 1,
+		},
+		{
+			name:    "invalid time",
+			content: "title: Kuchen\nbaking_time: zwanzig Minuten\nsteps:\n- ingredients:\n  - 200g Mehl\n  instructions: Backen.\n",
+			title:   "Kuchen", steps: 1, warnings: 1,
+		},
+		{
+			name:    "invalid temperature",
+			content: "title: Kuchen\nfan_temp: heiß\nsteps:\n- ingredients:\n  - 200g Mehl\n  instructions: Backen.\n",
+			title:   "Kuchen", steps: 1, warnings: 1,
+		},
+		{
+			name:    "no steps",
+			content: "title: Kuchen\n",
+			title:   "Kuchen", errors: 1,
+		},
+		{
+			name:    "empty title",
+			content: "steps:\n- instructions: Backen.\n",
+			steps:   1, errors: 1,
+		},
+		{
+			name:    "invalid YAML",
+			content: "title: [Kuchen\n",
+			errors:  1, fails: true,
+		},
+	}
+	for _, test := range tests {
+		parser := YamlParser{fakeFileReader{"kuchen.yaml": test.content}}
+		recipe, err := parser.ReadRecipe("kuchen")
+		if (err != nil) != test.fails {
+			t.Errorf("%s: ReadRecipe returned error %v", test.name, err)
+		}
+		if recipe.Title != test.title || len(recipe.Steps) != test.steps {
+			t.Errorf("%s: got title %q and %d steps, want %q and %d",
+				test.name, recipe.Title, len(recipe.Steps), test.title, test.steps)
+		}
+
+		diagnostics := parser.Lint("kuchen")
+		if diagnostics.Count(Warning) != test.warnings || diagnostics.Count(Error) != test.errors {
+			t.Errorf("%s: got diagnostics %v, want %d warnings and %d errors",
+				test.name, diagnostics, test.warnings, test.errors)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package apsa
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yzhs/apsa/units"
+)
+
+// defaultNutrients is extended by ~/.apsa/nutrients.csv if that file exists.
+//
+//go:embed nutrients.csv
+var defaultNutrients []byte
+
+// Weights of a pinch and a knife tip in grams
+var pinchWeights = map[string]float64{"Prise": 0.5, "Msp.": 0.5}
+
+// pieceUnits are used for things that are counted, as in "2 Eier" or
+// "1 Pck. Vanillezucker".  They are converted using the weight of a piece.
+var pieceUnits = map[string]bool{
+	"": true, "Stück": true, "Pck.": true, "Zehe": true, "Würfel": true,
+	"Scheibe": true, "Blatt": true,
+}
+
+// Nutrients are the energy in kcal and the macronutrients in g of some amount
+// of food.
+type Nutrients struct {
+	Energy        float64 `json:"energy"`
+	Protein       float64 `json:"protein"`
+	Fat           float64 `json:"fat"`
+	Carbohydrates float64 `json:"carbohydrates"`
+}
+
+func (n Nutrients) String() string {
+	return fmt.Sprintf("%s kcal, %s g Eiweiß, %s g Fett, %s g Kohlenhydrate",
+		formatNumber(n.Energy), formatNumber(n.Protein), formatNumber(n.Fat),
+		formatNumber(n.Carbohydrates))
+}
+
+// addScaled adds factor times other to n.
+func (n Nutrients) addScaled(other Nutrients, factor float64) Nutrients {
+	return Nutrients{
+		n.Energy + factor*other.Energy,
+		n.Protein + factor*other.Protein,
+		n.Fat + factor*other.Fat,
+		n.Carbohydrates + factor*other.Carbohydrates,
+	}
+}
+
+// round rounds the energy to whole kcal and the nutrients to tenths of a gram.
+func (n Nutrients) round() Nutrients {
+	tenths := func(x float64) float64 { return math.Round(x*10) / 10 }
+	return Nutrients{math.Round(n.Energy), tenths(n.Protein), tenths(n.Fat), tenths(n.Carbohydrates)}
+}
+
+// NutrientEntry describes the nutrients of an ingredient.
+type NutrientEntry struct {
+	Name string
+
+	// Nutrients contained in 100g of the ingredient
+	Nutrients Nutrients
+
+	// Density in g/ml and weight of a single piece in g, zero if unknown
+	Density     float64
+	PieceWeight float64
+}
+
+// grams converts a quantity of the ingredient to grams.
+func (e NutrientEntry) grams(q Quantity) (float64, bool) {
+	amount := q.Amount.Mean()
+	if _, ok := units.Lookup(q.Unit); ok {
+		return units.Grams(amount, q.Unit, e.Density)
+	}
+	if weight, ok := pinchWeights[q.Unit]; ok {
+		return amount * weight, true
+	}
+	return amount * e.PieceWeight, pieceUnits[q.Unit] && e.PieceWeight != 0
+}
+
+// NutrientTable maps normalised ingredient names to their nutrients.
+type NutrientTable map[string]NutrientEntry
+
+// ReadNutrientTable reads the built-in nutrient table and adds the entries in
+// ~/.apsa/nutrients.csv, if that file exists.
+func ReadNutrientTable() (NutrientTable, error) {
+	table := make(NutrientTable)
+	if err := table.parse(defaultNutrients); err != nil {
+		return nil, fmt.Errorf("nutrients.csv: %w", err)
+	}
+
+	filename := Config.ApsaDirectory + "nutrients.csv"
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return table, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := table.parse(content); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return table, nil
+}
+
+// parse adds the entries of a CSV file with the columns name, kcal, protein,
+// fat, carbohydrates, density and piece weight to the table.  The last two
+// columns are optional.
+func (t NutrientTable) parse(content []byte) error {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 5 || len(record) > 7 {
+			return fmt.Errorf("line %d: expected 5 to 7 columns, got %d", line, len(record))
+		}
+
+		var values [6]float64
+		for i, field := range record[1:] {
+			field = strings.TrimSpace(field)
+			if field == "" && i >= 4 {
+				continue
+			}
+			values[i], err = strconv.ParseFloat(field, 64)
+			if err != nil || values[i] < 0 {
+				return fmt.Errorf("line %d: invalid number '%s'", line, field)
+			}
+		}
+		name := strings.TrimSpace(record[0])
+		t[ingredientKey(name)] = NutrientEntry{
+			Name:        name,
+			Nutrients:   Nutrients{values[0], values[1], values[2], values[3]},
+			Density:     values[4],
+			PieceWeight: values[5],
+		}
+	}
+}
+
+// Find looks up an ingredient using the longest matching entry.
+func (t NutrientTable) Find(name string) (NutrientEntry, bool) {
+	name = ingredientKey(name)
+	best, longest := "", 0
+	for entry := range t {
+		if !ingredientMatches(name, entry) {
+			continue
+		}
+		n := utf8.RuneCountInString(entry)
+		if n > longest || n == longest && entry < best {
+			best, longest = entry, n
+		}
+	}
+	entry, ok := t[best]
+	return entry, ok && longest > 0
+}
+
+// Nutrition is the estimated nutritional value of a recipe.
+type Nutrition struct {
+	Total Nutrients `json:"total"`
+
+	// PerPortion is nil if the number of portions is unknown.  For ranges
+	// such as "6 bis 8", the middle of the range is used.
+	PerPortion *Nutrients `json:"per_portion"`
+
+	// Unmatched lists the ingredients missing from the nutrient table or
+	// whose amount could not be converted into grams.  They are not part of
+	// the estimate.
+	Unmatched []ShoppingItem `json:"unmatched"`
+}
+
+// Estimate computes the nutritional value of a recipe from its ingredients.
+func (t NutrientTable) Estimate(recipe ModernistRecipe) Nutrition {
+	var result Nutrition
+	for _, item := range mergeIngredients([]ModernistRecipe{recipe}) {
+		entry, ok := t.Find(item.Name)
+		weight := 0.0
+		ok = ok && len(item.Quantities) > 0
+		for _, quantity := range item.Quantities {
+			grams, converted := entry.grams(quantity)
+			ok = ok && converted
+			weight += grams
+		}
+		if !ok {
+			result.Unmatched = append(result.Unmatched, item)
+			continue
+		}
+		result.Total = result.Total.addScaled(entry.Nutrients, weight/100)
+	}
+
+	if portions, _, ok := parsePortions(recipe.Portions); ok {
+		perPortion := Nutrients{}.addScaled(result.Total, 1/portions.Mean()).round()
+		result.PerPortion = &perPortion
+	}
+	result.Total = result.Total.round()
+	return result
+}
@@ -0,0 +1,177 @@
+package apsa
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+const testNutrients = `# name,kcal,protein,fat,carbohydrates,density,piece
+Mehl,340,10,1,71,0.55,
+Weizenmehl,350,11,1,72
+Zucker,400,0,0,100,0.85,
+Vanillezucker,400,0,0,100,0.85,8
+Milch,64,3.4,3.5,4.8,1.03,
+Ei,150,12.8,10.5,0.7,,55
+Eier,150,12.8,10.5,0.7,,55
+Knoblauch,140,6,0.1,28,,4
+Salz,0,0,0,0,1.2,
+`
+
+func TestNutrientTableParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		entries int
+		fails   bool
+	}{
+		{"valid", testNutrients, 9, false},
+		{"comments only", "# name,kcal\n", 0, false},
+		{"five columns", "Mehl,340,10,1,71\n", 1, false},
+		{"too few columns", "Mehl,340,10,1\n", 0, true},
+		{"too many columns", "Mehl,340,10,1,71,0.55,,1\n", 0, true},
+		{"negative", "Mehl,340,-10,1,71\n", 0, true},
+		{"not a number", "Mehl,viel,10,1,71\n", 0, true},
+		{"empty nutrient", "Mehl,340,,1,71\n", 0, true},
+	}
+	for _, test := range tests {
+		table := make(NutrientTable)
+		err := table.parse([]byte(test.content))
+		if (err != nil) != test.fails {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if !test.fails && len(table) != test.entries {
+			t.Errorf("%s: got %d entries, want %d", test.name, len(table), test.entries)
+		}
+	}
+
+	table := make(NutrientTable)
+	if err := table.parse([]byte(testNutrients)); err != nil {
+		t.Fatal(err)
+	}
+	if got := table["ei"]; got.Name != "Ei" || got.Density != 0 || got.PieceWeight != 55 || got.Nutrients.Protein != 12.8 {
+		t.Errorf("got %+v for Ei", got)
+	}
+}
+
+func TestReadNutrientTable(t *testing.T) {
+	dir := t.TempDir() + "/"
+	previous := Config.ApsaDirectory
+	Config.ApsaDirectory = dir
+	t.Cleanup(func() { Config.ApsaDirectory = previous })
+
+	builtin, err := ReadNutrientTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := builtin.Find("Mehl"); !ok {
+		t.Error("the built-in table has no entry for Mehl")
+	}
+
+	user := "mehl,100,1,1,1\nKaktusfeige,40,1,0.5,10,,60\n"
+	if err := os.WriteFile(dir+"nutrients.csv", []byte(user), 0644); err != nil {
+		t.Fatal(err)
+	}
+	table, err := ReadNutrientTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := table.Find("Mehl"); entry.Nutrients.Energy != 100 {
+		t.Errorf("Mehl has %v kcal, want the 100 kcal from the user's table", entry.Nutrients.Energy)
+	}
+	if _, ok := table.Find("Kaktusfeige"); !ok || len(table) != len(builtin)+1 {
+		t.Errorf("got %d entries, want %d", len(table), len(builtin)+1)
+	}
+
+	if err := os.WriteFile(dir+"nutrients.csv", []byte("Mehl,100\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadNutrientTable(); err == nil {
+		t.Error("ReadNutrientTable should fail for an invalid user table")
+	}
+}
+
+func TestNutrientTableFind(t *testing.T) {
+	table := make(NutrientTable)
+	if err := table.parse([]byte(testNutrients)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Mehl", "Mehl"},
+		{"Weizenmehl", "Weizenmehl"},
+		{"Dinkelmehl", "Mehl"},
+		{"Bourbon-Vanillezucker", "Vanillezucker"},
+		{"brauner Zucker", "Zucker"},
+		{"Ei", "Ei"},
+		{"Eis", ""},
+		{"Zimt", ""},
+	}
+	for _, test := range tests {
+		entry, ok := table.Find(test.name)
+		if ok != (test.want != "") || entry.Name != test.want {
+			t.Errorf("Find(%q) = %q, %v, want %q", test.name, entry.Name, ok, test.want)
+		}
+	}
+}
+
+func TestNutrientEntryGrams(t *testing.T) {
+	table := make(NutrientTable)
+	if err := table.parse([]byte(testNutrients)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		entry  string
+		amount float64
+		unit   string
+		want   float64
+		ok     bool
+	}{
+		{"Mehl", 1, "kg", 1000, true},
+		{"Mehl", 100, "ml", 55, true},
+		{"Milch", 1, "l", 1030, true},
+		{"Salz", 2, "Prise", 1, true},
+		{"Zucker", 1, "Msp.", 0.5, true},
+		{"Ei", 2, "", 110, true},
+		{"Vanillezucker", 1, "Pck.", 8, true},
+		{"Knoblauch", 2, "Zehe", 8, true},
+		{"Ei", 1, "EL", 0, false},
+		{"Mehl", 2, "", 0, false},
+		{"Knoblauch", 1, "Bund", 0, false},
+	}
+	for _, test := range tests {
+		q := Quantity{Amount{test.amount, test.amount}, test.unit}
+		got, ok := table[ingredientKey(test.entry)].grams(q)
+		if ok != test.ok || ok && math.Abs(got-test.want) > 0.01 {
+			t.Errorf("grams(%v %s %s) = %v, %v, want %v, %v",
+				test.amount, test.unit, test.entry, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	table := make(NutrientTable)
+	if err := table.parse([]byte(testNutrients)); err != nil {
+		t.Fatal(err)
+	}
+	recipe := testRecipe("pfannkuchen", "200g Mehl", "2 Eier", "400ml Milch", "1 Prise Salz", "1 Bund Petersilie")
+	recipe.Portions = "3 bis 5"
+	got := table.Estimate(recipe)
+	if want := (Nutrients{1109, 48.1, 28, 162.5}); got.Total != want {
+		t.Errorf("got total %v, want %v", got.Total, want)
+	}
+	if want := (Nutrients{277, 12, 7, 40.6}); got.PerPortion == nil || *got.PerPortion != want {
+		t.Errorf("got %v per portion, want %v", got.PerPortion, want)
+	}
+	if len(got.Unmatched) != 1 || got.Unmatched[0].Name != "Petersilie" {
+		t.Errorf("got unmatched ingredients %v, want Petersilie", got.Unmatched)
+	}
+
+	recipe.Portions = ""
+	if got := table.Estimate(recipe); got.PerPortion != nil {
+		t.Errorf("got %v per portion for unknown portions", got.PerPortion)
+	}
+}
@@ -0,0 +1,201 @@
+package apsa
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"gopkg.in/yaml.v2"
+
+	"github.com/yzhs/apsa/units"
+)
+
+// ErrEmptyPantry is returned when searching for recipes using an empty pantry.
+var ErrEmptyPantry = errors.New("the pantry is empty")
+
+// maxPantryCandidates is the maximal number of recipes ranked by how well the
+// pantry covers them.  They are ranked using the ingredients stored in the
+// index, so only the recipes shown have to be read from disk.
+const maxPantryCandidates = 10000
+
+// Pantry lists the ingredients at hand, such as "2kg Mehl" or "Salz".  Items
+// without an amount are assumed to be available in any quantity.
+type Pantry []Ingredient
+
+// PantryFile returns the name of the default pantry file.
+func PantryFile() string {
+	return Config.ApsaDirectory + "pantry.yaml"
+}
+
+// ReadPantry reads a YAML list of ingredients.
+func ReadPantry(filename string) (Pantry, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var pantry Pantry
+	if err := yaml.Unmarshal(content, &pantry); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return pantry, nil
+}
+
+// PantryMatch describes how well the pantry covers the ingredients of a
+// recipe.
+type PantryMatch struct {
+	Id      Id             `json:"id"`
+	Covered int            `json:"covered"`
+	Total   int            `json:"total"`
+	Missing []ShoppingItem `json:"missing"`
+}
+
+// Coverage returns the fraction of the ingredients of the recipe that are in
+// the pantry.
+func (m PantryMatch) Coverage() float64 {
+	if m.Total == 0 {
+		return 0
+	}
+	return float64(m.Covered) / float64(m.Total)
+}
+
+// Match checks which ingredients of the recipe are in the pantry in
+// sufficient quantities.
+func (p Pantry) Match(recipe ModernistRecipe) PantryMatch {
+	match := PantryMatch{Id: recipe.Id}
+	for _, item := range mergeIngredients([]ModernistRecipe{recipe}) {
+		match.Total++
+		if p.Covers(item) {
+			match.Covered++
+		} else {
+			match.Missing = append(match.Missing, item)
+		}
+	}
+	return match
+}
+
+// matchNames estimates how well the pantry covers a recipe given the names of
+// its ingredients as stored in the index.  Since amounts are ignored, Match
+// can only be worse.
+func (p Pantry) matchNames(id Id, names []string) PantryMatch {
+	match := PantryMatch{Id: id, Total: len(names)}
+	for _, name := range names {
+		item := ShoppingItem{Name: name}
+		if p.Covers(item) {
+			match.Covered++
+		} else {
+			match.Missing = append(match.Missing, item)
+		}
+	}
+	return match
+}
+
+// Covers reports whether the pantry contains enough of an ingredient.  Amounts
+// are only compared if their units can be converted into each other.
+func (p Pantry) Covers(item ShoppingItem) bool {
+	name := ingredientKey(item.Name)
+	var stock ShoppingItem
+	found, unlimited := false, false
+	for _, ingredient := range p {
+		entry := ingredient.Name
+		if entry == "" {
+			entry = ingredient.String()
+		}
+		// Unlike categories, the pantry has to match whole words: Zucker
+		// is no substitute for Puderzucker.
+		if findWord(name, ingredientKey(entry)) < 0 {
+			continue
+		}
+		found = true
+		if ingredient.Amount.IsZero() {
+			unlimited = true
+		} else {
+			stock.addQuantity(Quantity{ingredient.Amount, ingredient.Unit})
+		}
+	}
+	if !found {
+		return false
+	}
+	if unlimited {
+		return true
+	}
+
+	for _, needed := range item.Quantities {
+		for _, available := range stock.Quantities {
+			if enough, ok := available.covers(needed); ok && !enough {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// covers reports whether q is at least as much as needed.  The second result
+// is false if the units are incompatible.
+func (q Quantity) covers(needed Quantity) (bool, bool) {
+	if q.Unit == needed.Unit {
+		return q.Amount.Min >= needed.Amount.Max, true
+	}
+	if !units.Compatible(q.Unit, needed.Unit) {
+		return false, false
+	}
+	amount, _ := units.Convert(needed.Amount.Max, needed.Unit, q.Unit)
+	return q.Amount.Min >= amount, true
+}
+
+// pantryQuery restricts a query to recipes using at least one of the
+// ingredients in the pantry.
+func pantryQuery(q query.Query, pantry Pantry) query.Query {
+	ingredients := bleve.NewDisjunctionQuery()
+	for _, ingredient := range pantry {
+		name := ingredient.Name
+		if name == "" {
+			name = ingredient.String()
+		}
+		match := bleve.NewMatchQuery(name)
+		match.SetField(ingredientsField)
+		ingredients.AddQuery(match)
+	}
+	return bleve.NewConjunctionQuery(q, ingredients)
+}
+
+// betterMatch reports whether a recipe matching the pantry like a is ranked
+// before one matching like b, i.e. by the fraction of their ingredients that
+// are in the pantry and then by the number of missing ingredients.
+func betterMatch(a, b PantryMatch) bool {
+	if a.Coverage() != b.Coverage() {
+		return a.Coverage() > b.Coverage()
+	}
+	return len(a.Missing) < len(b.Missing)
+}
+
+// rankPantryCandidates returns the first n of the recipes ranked by
+// betterMatch, keeping the order of equally good matches.  The candidates are ordered by matchNames first, and recipes
+// are only read from disk as long as they can still be among the first n.
+func rankPantryCandidates(backend Backend, candidates []PantryMatch, pantry Pantry, n int) ([]ModernistRecipe, []PantryMatch) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return betterMatch(candidates[i], candidates[j])
+	})
+
+	var recipes []ModernistRecipe
+	var matches []PantryMatch
+	for _, candidate := range candidates {
+		if len(matches) >= n && !betterMatch(candidate, matches[n-1]) {
+			break
+		}
+		recipe, err := backend.ReadRecipe(candidate.Id)
+		if err != nil {
+			log.Println("Error reading recipe:", err)
+			recipe.Id = candidate.Id
+		}
+		match := pantry.Match(recipe)
+		i := sort.Search(len(matches), func(i int) bool { return betterMatch(match, matches[i]) })
+		recipes = slices.Insert(recipes, i, recipe)
+		matches = slices.Insert(matches, i, match)
+	}
+	return recipes[:min(n, len(recipes))], matches[:min(n, len(matches))]
+}
@@ -0,0 +1,89 @@
+package apsa
+
+import (
+	"sort"
+	"testing"
+)
+
+// fakeBackend serves recipes from memory and remembers which ones were read.
+type fakeBackend struct {
+	recipes map[Id]ModernistRecipe
+	read    []Id
+}
+
+func (b *fakeBackend) ReadRecipe(id Id) (ModernistRecipe, error) {
+	b.read = append(b.read, id)
+	return b.recipes[id], nil
+}
+
+func (b *fakeBackend) RecipeExists(id Id) bool {
+	_, ok := b.recipes[id]
+	return ok
+}
+
+func (b *fakeBackend) Lint(id Id) Diagnostics {
+	return nil
+}
+
+// rankByPantry ranks all recipes like rankPantryCandidates, but the obvious
+// way, to check the result of the latter.
+func rankByPantry(recipes []ModernistRecipe, pantry Pantry) ([]ModernistRecipe, []PantryMatch) {
+	matches := make([]PantryMatch, len(recipes))
+	order := make([]int, len(recipes))
+	for i, recipe := range recipes {
+		matches[i] = pantry.Match(recipe)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return betterMatch(matches[order[i]], matches[order[j]])
+	})
+
+	sortedRecipes := make([]ModernistRecipe, len(recipes))
+	sortedMatches := make([]PantryMatch, len(recipes))
+	for i, j := range order {
+		sortedRecipes[i], sortedMatches[i] = recipes[j], matches[j]
+	}
+	return sortedRecipes, sortedMatches
+}
+
+func TestRankPantryCandidates(t *testing.T) {
+	pantry := Pantry{ParseIngredient("Mehl"), ParseIngredient("2 Eier"), ParseIngredient("Salz")}
+	backend := &fakeBackend{recipes: map[Id]ModernistRecipe{
+		"brot":        testRecipe("brot", "500g Mehl", "1 TL Salz", "1 Würfel Hefe"),
+		"omelett":     testRecipe("omelett", "3 Eier", "Salz"),
+		"nudeln":      testRecipe("nudeln", "300g Mehl", "2 Eier"),
+		"kuchen":      testRecipe("kuchen", "200g Mehl", "4 Eier", "200g Zucker", "200g Butter"),
+		"obstsalat":   testRecipe("obstsalat", "2 Äpfel", "1 Banane"),
+		"spiegelei":   testRecipe("spiegelei", "1 Ei", "Salz"),
+		"pfannkuchen": testRecipe("pfannkuchen", "200g Mehl", "2 Eier", "400ml Milch"),
+	}}
+
+	var candidates []PantryMatch
+	var recipes []ModernistRecipe
+	for id, recipe := range backend.recipes {
+		var names []string
+		for _, item := range mergeIngredients([]ModernistRecipe{recipe}) {
+			names = append(names, ingredientKey(item.Name))
+		}
+		candidates = append(candidates, pantry.matchNames(id, names))
+		recipes = append(recipes, recipe)
+	}
+	_, want := rankByPantry(recipes, pantry)
+
+	for _, n := range []int{1, 3, len(recipes)} {
+		backend.read = nil
+		_, got := rankPantryCandidates(backend, append([]PantryMatch(nil), candidates...), pantry, n)
+		if len(got) != n {
+			t.Errorf("rankPantryCandidates(%d) returned %d matches", n, len(got))
+			continue
+		}
+		for i := range got {
+			if got[i].Coverage() != want[i].Coverage() || len(got[i].Missing) != len(want[i].Missing) {
+				t.Errorf("rankPantryCandidates(%d): match %d is %+v, want %+v", n, i, got[i], want[i])
+			}
+		}
+		if n < len(recipes) && len(backend.read) == len(recipes) {
+			t.Errorf("rankPantryCandidates(%d) read all recipes", n)
+		}
+	}
+}
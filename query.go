@@ -0,0 +1,238 @@
+package apsa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// durationFields maps the names of time filters usable in queries to the
+// indexed fields.
+var durationFields = map[string]string{
+	"zeit":             "total_time",
+	"gesamtzeit":       "total_time",
+	"zubereitungszeit": "preparation_time",
+	"kochzeit":         "cooking_time",
+	"backzeit":         "baking_time",
+	"wartezeit":        "waiting_time",
+}
+
+// parsedQuery is a query string split into the part handled by Bleve's query
+// string syntax and additional filters.
+type parsedQuery struct {
+	text    string
+	must    []query.Query
+	mustNot []query.Query
+}
+
+// parseQuery converts a query as entered by the user into a Bleve query.
+// Unless prefixed with '~', all terms are required.  Filters like
+// "zeit:<30m", "backzeit:>1h" or "portionen:4..6" restrict the results by
+// time or number of portions, "zutat:butter" or "-zutat:nüsse" by
+// ingredients, "-allergen:nüsse" or "diet:vegan" by what is derived from
+// them.
+func parseQuery(queryString string) (parsedQuery, error) {
+	var result parsedQuery
+	for _, word := range strings.Fields(queryString) {
+		negated := word[0] == '-'
+		field, value, isFilter := strings.Cut(strings.TrimLeft(word, "+-"), ":")
+		field = strings.ToLower(field)
+
+		var filter query.Query
+		var err error
+		if indexField, ok := durationFields[field]; isFilter && ok {
+			filter, err = rangeQuery(indexField, value, parseMinutes)
+		} else if isFilter && field == "portionen" {
+			filter, err = portionsQuery(value)
+		} else if isFilter && (field == "zutat" || field == "zutaten") {
+			filter, err = ingredientQuery(value)
+		} else if isFilter && (field == "allergen" || field == "allergene") {
+			filter = termQuery(allergensField, strings.ToLower(value))
+		} else if isFilter && (field == "diet" || field == "diät") {
+			filter = termQuery(dietField, strings.ToLower(value))
+		}
+		if err != nil {
+			return result, fmt.Errorf("invalid filter '%s': %v", word, err)
+		}
+		if filter != nil {
+			if negated {
+				result.mustNot = append(result.mustNot, filter)
+			} else {
+				result.must = append(result.must, filter)
+			}
+			continue
+		}
+
+		if word[0] == '-' || word[0] == '+' {
+			result.text += " " + word
+		} else if word[0] == '~' {
+			// Remove prefix to make term optional
+			result.text += " " + word[1:]
+		} else {
+			result.text += " +" + word
+		}
+	}
+	result.text = strings.TrimSpace(result.text)
+	return result, nil
+}
+
+// addTags restricts the query to recipes with the given tags.  Tags prefixed
+// with '-' must not be present.
+func (q *parsedQuery) addTags(tags []string) {
+	for _, tag := range tags {
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if tag[0] == '-' {
+			q.mustNot = append(q.mustNot, termQuery(tagField, tag[1:]))
+		} else {
+			q.must = append(q.must, termQuery(tagField, tag))
+		}
+	}
+}
+
+// ingredientQuery matches recipes with an ingredient containing the given
+// words.  Words of at least three letters also match compounds ending in them,
+// so that "-zutat:nüsse" excludes Haselnüsse as well.
+func ingredientQuery(value string) (query.Query, error) {
+	analyzer := bleve.NewIndexMapping().AnalyzerNamed("de")
+	tokens := analyzer.Analyze([]byte(value))
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no ingredient given")
+	}
+
+	result := bleve.NewConjunctionQuery()
+	for _, token := range tokens {
+		term := string(token.Term)
+		if utf8.RuneCountInString(term) < 3 {
+			result.AddQuery(termQuery(ingredientsField, term))
+			continue
+		}
+		wildcard := bleve.NewWildcardQuery("*" + term)
+		wildcard.SetField(ingredientsField)
+		result.AddQuery(wildcard)
+	}
+	return result, nil
+}
+
+func termQuery(field, term string) query.Query {
+	q := bleve.NewTermQuery(term)
+	q.SetField(field)
+	return q
+}
+
+// Query combines the text query and all filters into a single Bleve query.
+func (q parsedQuery) Query() query.Query {
+	must := q.must
+	if q.text != "" {
+		must = append([]query.Query{bleve.NewQueryStringQuery(q.text)}, must...)
+	}
+	if len(must) == 0 {
+		must = []query.Query{bleve.NewMatchAllQuery()}
+	}
+	if len(must) == 1 && len(q.mustNot) == 0 {
+		return must[0]
+	}
+
+	result := bleve.NewBooleanQuery()
+	result.AddMust(must...)
+	result.AddMustNot(q.mustNot...)
+	return result
+}
+
+func parseMinutes(s string) (float64, error) {
+	d, err := ParseDuration(s)
+	return d.Minutes(), err
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+}
+
+// numericRange describes the bounds of a filter like "<30m" or "4..6".  Nil
+// bounds are unrestricted.
+type numericRange struct {
+	min, max                   *float64
+	minInclusive, maxInclusive bool
+}
+
+func parseRange(value string, parse func(string) (float64, error)) (numericRange, error) {
+	var r numericRange
+	if value == "" {
+		return r, fmt.Errorf("empty range")
+	}
+	bound := func(s string) (*float64, error) {
+		if strings.TrimSpace(s) == "" {
+			return nil, fmt.Errorf("missing bound")
+		}
+		x, err := parse(s)
+		return &x, err
+	}
+
+	var err error
+	switch {
+	case strings.HasPrefix(value, "<="):
+		r.max, err = bound(value[2:])
+		r.maxInclusive = true
+	case strings.HasPrefix(value, ">="):
+		r.min, err = bound(value[2:])
+		r.minInclusive = true
+	case strings.HasPrefix(value, "<"):
+		r.max, err = bound(value[1:])
+	case strings.HasPrefix(value, ">"):
+		r.min, err = bound(value[1:])
+	case strings.Contains(value, ".."):
+		from, to, _ := strings.Cut(value, "..")
+		r.minInclusive, r.maxInclusive = true, true
+		if from != "" {
+			r.min, err = bound(from)
+		}
+		if err == nil && to != "" {
+			r.max, err = bound(to)
+		}
+		if from == "" && to == "" {
+			err = fmt.Errorf("empty range")
+		}
+	default:
+		r.min, err = bound(strings.TrimPrefix(value, "="))
+		r.max = r.min
+		r.minInclusive, r.maxInclusive = true, true
+	}
+	return r, err
+}
+
+func numericRangeQuery(field string, min, max *float64, minInclusive, maxInclusive bool) query.Query {
+	q := bleve.NewNumericRangeInclusiveQuery(min, max, &minInclusive, &maxInclusive)
+	q.SetField(field)
+	return q
+}
+
+func rangeQuery(field, value string, parse func(string) (float64, error)) (query.Query, error) {
+	r, err := parseRange(value, parse)
+	if err != nil {
+		return nil, err
+	}
+	return numericRangeQuery(field, r.min, r.max, r.minInclusive, r.maxInclusive), nil
+}
+
+// portionsQuery matches all recipes whose range of portions overlaps with the
+// given one.
+func portionsQuery(value string) (query.Query, error) {
+	r, err := parseRange(value, parseFloat)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []query.Query
+	if r.min != nil {
+		queries = append(queries, numericRangeQuery("portions_max", r.min, nil, r.minInclusive, false))
+	}
+	if r.max != nil {
+		queries = append(queries, numericRangeQuery("portions_min", nil, r.max, false, r.maxInclusive))
+	}
+	return bleve.NewConjunctionQuery(queries...), nil
+}
@@ -0,0 +1,59 @@
+package apsa
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	value := func(x float64) *float64 { return &x }
+	tests := []struct {
+		text string
+		want numericRange
+	}{
+		{"<30m", numericRange{max: value(30)}},
+		{"<=1h", numericRange{max: value(60), maxInclusive: true}},
+		{">1h", numericRange{min: value(60)}},
+		{">=90", numericRange{min: value(90), minInclusive: true}},
+		{"20..40", numericRange{value(20), value(40), true, true}},
+		{"..40", numericRange{nil, value(40), true, true}},
+		{"20..", numericRange{value(20), nil, true, true}},
+		{"45", numericRange{value(45), value(45), true, true}},
+	}
+	equal := func(a, b *float64) bool {
+		return a == nil && b == nil || a != nil && b != nil && *a == *b
+	}
+	for _, test := range tests {
+		got, err := parseRange(test.text, parseMinutes)
+		if err != nil {
+			t.Errorf("parseRange(%q): %v", test.text, err)
+			continue
+		}
+		if !equal(got.min, test.want.min) || !equal(got.max, test.want.max) ||
+			got.minInclusive != test.want.minInclusive || got.maxInclusive != test.want.maxInclusive {
+			t.Errorf("parseRange(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+
+	for _, text := range []string{"", "<", "<=", ">", ">=", "=", "..", "<abc"} {
+		if _, err := parseRange(text, parseMinutes); err == nil {
+			t.Errorf("parseRange(%q) should fail", text)
+		}
+	}
+}
+
+func TestParseQueryFilters(t *testing.T) {
+	q, err := parseQuery("stollen zeit:<2h -zutat:nüsse diet:vegan ~rum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.text != "+stollen rum" {
+		t.Errorf("text query is %q", q.text)
+	}
+	if len(q.must) != 2 || len(q.mustNot) != 1 {
+		t.Errorf("got %d required and %d excluded filters, want 2 and 1", len(q.must), len(q.mustNot))
+	}
+
+	for _, text := range []string{"zeit:<", "portionen:", "zutat:", "backzeit:lange"} {
+		if _, err := parseQuery(text); err == nil {
+			t.Errorf("parseQuery(%q) should fail", text)
+		}
+	}
+}
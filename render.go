@@ -0,0 +1,64 @@
+package apsa
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnsupportedFormat is returned when asking for a renderer for an unknown
+// or not yet supported output format.
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// NewCookbookRenderer returns a renderer for the given format, which is one
+// of "pdf", "html" or "epub".
+func NewCookbookRenderer(format string) (CookbookRenderer, error) {
+	switch format {
+	case "pdf":
+		return NewLatexRenderer(), nil
+	case "html":
+		return NewHtmlRenderer(), nil
+	case "epub":
+		return NewEpubRenderer(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// isUpToDate reports whether a rendered recipe is newer than the file the
+// recipe is stored in.
+func isUpToDate(id Id, output string) (bool, error) {
+	file, err := recipeFile(id)
+	if err != nil {
+		return false, err
+	}
+	recipeTime, err := getModTime(Config.KnowledgeDirectory + file)
+	if err != nil {
+		return false, err
+	}
+	outputTime, err := getModTime(output)
+	return err == nil && outputTime >= recipeTime, nil
+}
+
+// RenderAll renders the given recipes, at most Config.MaxProcs at a time.
+func RenderAll(renderer Renderer, ids []Id) error {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs []error
+	slots := make(chan struct{}, max(Config.MaxProcs, 1))
+	for _, id := range ids {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(id Id) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := renderer.Render(id); err != nil {
+				mutex.Lock()
+				errs = append(errs, err)
+				mutex.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,219 @@
+package apsa
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yzhs/apsa/units"
+)
+
+// Scale returns a copy of the recipe with all ingredient amounts multiplied by
+// factor.
+func Scale(recipe ModernistRecipe, factor float64) ModernistRecipe {
+	result := recipe
+	result.Steps = make([]Step, len(recipe.Steps))
+	for i, step := range recipe.Steps {
+		result.Steps[i] = step
+		result.Steps[i].Ingredients = make([]Ingredient, len(step.Ingredients))
+		for j, ingredient := range step.Ingredients {
+			result.Steps[i].Ingredients[j] = ingredient.Scale(factor)
+		}
+	}
+
+	if portions, noun, ok := parsePortions(recipe.Portions); ok {
+		result.Portions = formatPortions(Amount{portions.Min * factor, portions.Max * factor}.round(1), noun)
+	}
+
+	return result
+}
+
+// ScaleToPortions scales the recipe such that it yields the given number of
+// portions.  If the recipe gives a range of portions like "6 bis 8", the
+// middle of that range is used.
+func ScaleToPortions(recipe ModernistRecipe, portions float64) (ModernistRecipe, error) {
+	if portions <= 0 {
+		return recipe, fmt.Errorf("invalid number of portions: %v", portions)
+	}
+	original, noun, ok := parsePortions(recipe.Portions)
+	if !ok {
+		return recipe, fmt.Errorf("cannot scale recipe %s: unknown number of portions '%s'", recipe.Id, recipe.Portions)
+	}
+
+	result := Scale(recipe, portions/original.Mean())
+	result.Portions = formatPortions(Amount{portions, portions}, noun)
+	return result, nil
+}
+
+// parsePortions parses the number of portions a recipe yields, which may be
+// followed by what the portions are, as in "4 Personen" or "1 Blech".
+func parsePortions(s string) (Amount, string, bool) {
+	portions, noun := parseAmount(strings.TrimSpace(s))
+	return portions, noun, !portions.IsZero()
+}
+
+// ConvertUnits returns a copy of the recipe with all amounts and oven
+// temperatures expressed in units of the given system.  The densities in the
+// nutrient table, which may be nil, are used to convert cups into grams.
+func ConvertUnits(recipe ModernistRecipe, system units.System, nutrients NutrientTable) ModernistRecipe {
+	if system == units.Original {
+		return recipe
+	}
+	result := recipe
+	result.Steps = make([]Step, len(recipe.Steps))
+	for i, step := range recipe.Steps {
+		result.Steps[i] = step
+		result.Steps[i].Ingredients = make([]Ingredient, len(step.Ingredients))
+		for j, ingredient := range step.Ingredients {
+			entry, _ := nutrients.Find(ingredient.Name)
+			result.Steps[i].Ingredients[j] = ingredient.ConvertUnits(system, entry.Density)
+		}
+	}
+	result.FanTemp = recipe.FanTemp.convertUnits(system)
+	result.TopAndBottomHeatTemp = recipe.TopAndBottomHeatTemp.convertUnits(system)
+	return result
+}
+
+func formatPortions(portions Amount, noun string) string {
+	result := formatNumber(portions.Min)
+	if portions.IsRange() {
+		result += " bis " + formatNumber(portions.Max)
+	}
+	if noun != "" {
+		result += " " + inflect(noun, portions)
+	}
+	return result
+}
+
+// nounForms lists the singular and plural of nouns that are commonly counted
+// in recipes, so that scaling "3 Eier" down yields "1 Ei" rather than "1 Eier".
+var nounForms = []struct{ singular, plural string }{
+	{"Ei", "Eier"},
+	{"Person", "Personen"},
+	{"Portion", "Portionen"},
+	{"Blech", "Bleche"},
+	{"Form", "Formen"},
+	{"Apfel", "Äpfel"},
+	{"Banane", "Bananen"},
+	{"Birne", "Birnen"},
+	{"Zitrone", "Zitronen"},
+	{"Limette", "Limetten"},
+	{"Orange", "Orangen"},
+	{"Zwiebel", "Zwiebeln"},
+	{"Schalotte", "Schalotten"},
+	{"Kartoffel", "Kartoffeln"},
+	{"Tomate", "Tomaten"},
+	{"Möhre", "Möhren"},
+	{"Karotte", "Karotten"},
+	{"Paprikaschote", "Paprikaschoten"},
+	{"Chilischote", "Chilischoten"},
+	{"Gurke", "Gurken"},
+	{"Zucchini", "Zucchini"},
+	{"Knoblauchzehe", "Knoblauchzehen"},
+	{"Brötchen", "Brötchen"},
+}
+
+// inflect puts a noun, or a compound ending in one, into the singular if the
+// amount is at most one and into the plural otherwise.  Unknown nouns are
+// kept as they are.  Forms shorter than three letters, like "Ei", are only
+// replaced as whole words, so that "Brei" stays as it is.
+func inflect(noun string, amount Amount) string {
+	for _, forms := range nounForms {
+		from, to := forms.plural, forms.singular
+		if amount.Max > 1 {
+			from, to = to, from
+		}
+		i := len(noun) - len(from)
+		if i < 0 || !strings.EqualFold(noun[i:], from) {
+			continue
+		}
+		if i > 0 && noun[i-1] != ' ' && noun[i-1] != '-' {
+			if utf8.RuneCountInString(from) < 3 {
+				continue
+			}
+			to = strings.ToLower(to)
+		}
+		return noun[:i] + to
+	}
+	return noun
+}
+
+// Scale multiplies the amount of the ingredient by factor, rounding the result
+// to a precision that makes sense for the unit.
+func (i Ingredient) Scale(factor float64) Ingredient {
+	if i.Amount.IsZero() || factor == 1 {
+		return i
+	}
+	i.Amount = Amount{i.Amount.Min * factor, i.Amount.Max * factor}.roundForUnit(i.Unit)
+
+	// The name is kept, so that the shopping list still merges the scaled
+	// ingredient with unscaled ones.  Only the text uses the right form.
+	formatted := i
+	if i.Unit == "" {
+		formatted.Name = inflect(i.Name, i.Amount)
+	}
+	i.Text = formatted.Format()
+	return i
+}
+
+// ConvertUnits expresses the amount of the ingredient in units of the given
+// system, rounded like scaled amounts.  In metric, cups are converted into
+// grams if the density of the ingredient in g/ml is known, since dry
+// ingredients are weighed rather than measured in German recipes.
+func (i Ingredient) ConvertUnits(system units.System, density float64) Ingredient {
+	if i.Amount.IsZero() {
+		return i
+	}
+	var amount Amount
+	unit := i.Unit
+	if system == units.Metric && i.Unit == "cup" && density != 0 {
+		amount.Min, _ = units.Grams(i.Amount.Min, i.Unit, density)
+		amount.Max, _ = units.Grams(i.Amount.Max, i.Unit, density)
+		unit = "g"
+	} else {
+		amount.Max, unit = system.Convert(i.Amount.Max, i.Unit)
+		amount.Min, _ = units.Convert(i.Amount.Min, i.Unit, unit)
+	}
+	if unit == i.Unit {
+		return i
+	}
+	i.Amount, i.Unit = amount.roundForUnit(unit), unit
+	i.Text = i.Format()
+	return i
+}
+
+// roundForUnit rounds the amount to a precision suitable for the given unit.
+// There is no such thing as a third of an egg or 323.7g of flour.
+func (a Amount) roundForUnit(unit string) Amount {
+	switch unit {
+	case "g", "mg", "ml":
+		switch {
+		case a.Max < 20:
+			return a.round(1)
+		case a.Max < 200:
+			return a.round(5)
+		default:
+			return a.round(10)
+		}
+	case "kg", "l":
+		return a.round(0.05)
+	case "cl", "dl", "oz":
+		return a.round(0.5)
+	case "EL", "TL", "Tasse", "cup", "tbsp", "tsp", "lb":
+		return a.round(0.25)
+	default:
+		// Things you count, like eggs, onions or pinches of salt.  Half a
+		// lemon is fine, a third of an egg is not.
+		return a.round(0.5)
+	}
+}
+
+// round rounds both ends of the range to a multiple of step, but never below
+// step itself.
+func (a Amount) round(step float64) Amount {
+	roundValue := func(x float64) float64 {
+		return math.Max(step, math.Round(x/step)*step)
+	}
+	return Amount{roundValue(a.Min), roundValue(a.Max)}
+}
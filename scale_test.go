@@ -0,0 +1,52 @@
+package apsa
+
+import "testing"
+
+func TestScaleToPortions(t *testing.T) {
+	tests := []struct {
+		original     string
+		ingredients  []string
+		portions     float64
+		wantPortions string
+		want         []string
+	}{
+		{"4", []string{"200g Mehl", "2 Eier"}, 2, "2", []string{"100g Mehl", "1 Ei"}},
+		{"4 Personen", []string{"500g Mehl"}, 6, "6 Personen", []string{"750g Mehl"}},
+		{"1 Blech", []string{"1 TL Salz"}, 2, "2 Bleche", []string{"2 TL Salz"}},
+		{"4 Personen", []string{"2 rote Zwiebeln", "4 Hühnereier"}, 1, "1 Person", []string{"0,5 rote Zwiebel", "1 Hühnerei"}},
+		{"1 Person", []string{"1 Apfel", "1 Bratapfel", "1 Schüssel Brei"}, 3, "3 Personen", []string{"3 Äpfel", "3 Bratäpfel", "3 Schüssel Brei"}},
+		{"6 bis 8", []string{"1400g Mehl"}, 14, "14", []string{"2800g Mehl"}},
+		{"4", []string{"½ Zitrone"}, 2, "2", []string{"0,5 Zitrone"}},
+		{"4", []string{"3 Eier"}, 1, "1", []string{"1 Ei"}},
+		{"4", []string{"1 Ei"}, 1, "1", []string{"0,5 Ei"}},
+		{"2", []string{"Salz"}, 4, "4", []string{"Salz"}},
+	}
+	for _, test := range tests {
+		recipe := testRecipe("test", test.ingredients...)
+		recipe.Portions = test.original
+		scaled, err := ScaleToPortions(recipe, test.portions)
+		if err != nil {
+			t.Errorf("ScaleToPortions(%q, %v): %v", test.original, test.portions, err)
+			continue
+		}
+		if scaled.Portions != test.wantPortions {
+			t.Errorf("ScaleToPortions(%q, %v) yields %q portions, want %q",
+				test.original, test.portions, scaled.Portions, test.wantPortions)
+		}
+		for i, ingredient := range scaled.Steps[0].Ingredients {
+			if ingredient.String() != test.want[i] {
+				t.Errorf("ScaleToPortions(%q, %v): ingredient %d is %q, want %q",
+					test.original, test.portions, i, ingredient, test.want[i])
+			}
+		}
+	}
+}
+
+func TestScaleToPortionsUnknown(t *testing.T) {
+	for _, portions := range []string{"", "einige", "ein Blech"} {
+		recipe := ModernistRecipe{Id: "test", Portions: portions}
+		if _, err := ScaleToPortions(recipe, 4); err == nil {
+			t.Errorf("ScaleToPortions(%q, 4) should fail", portions)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package apsa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoRecipeFound is returned when a web page does not describe a recipe
+// using schema.org JSON-LD.
+var ErrNoRecipeFound = errors.New("no schema.org recipe found")
+
+var (
+	jsonLdRegexp = regexp.MustCompile(
+		`(?is)<script[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+	htmlBreakRegexp   = regexp.MustCompile(`(?i)<(?:br|/p|/li|/div)\b[^>]*>`)
+	htmlTagRegexp     = regexp.MustCompile(`<[^>]*>`)
+	isoDurationRegexp = regexp.MustCompile(
+		`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+// ImportSchemaOrg extracts the first recipe described using schema.org JSON-LD
+// from an HTML page.  Values that cannot be imported are dropped and
+// described in the second result.
+func ImportSchemaOrg(page []byte) (ModernistRecipe, []string, error) {
+	for _, match := range jsonLdRegexp.FindAllSubmatch(page, -1) {
+		var data interface{}
+		if err := json.Unmarshal(match[1], &data); err != nil {
+			// Some pages contain broken JSON-LD in addition to the
+			// recipe, so keep looking.
+			continue
+		}
+		if object := findSchemaOrgRecipe(data); object != nil {
+			return schemaOrgRecipe(object)
+		}
+	}
+	return ModernistRecipe{}, nil, ErrNoRecipeFound
+}
+
+// findSchemaOrgRecipe looks for an object of type Recipe, either at the top
+// level, in a list, or in a @graph.
+func findSchemaOrgRecipe(data interface{}) map[string]interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if object := findSchemaOrgRecipe(item); object != nil {
+				return object
+			}
+		}
+	case map[string]interface{}:
+		if hasSchemaOrgType(v, "Recipe") {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findSchemaOrgRecipe(graph)
+		}
+		if entity, ok := v["mainEntity"]; ok {
+			return findSchemaOrgRecipe(entity)
+		}
+	}
+	return nil
+}
+
+func hasSchemaOrgType(object map[string]interface{}, typ string) bool {
+	switch t := object["@type"].(type) {
+	case string:
+		return t == typ
+	case []interface{}:
+		for _, item := range t {
+			if item == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// schemaOrgRecipe converts a schema.org Recipe.  All ingredients belong to
+// the first step since schema.org does not say which step they are used in.
+func schemaOrgRecipe(object map[string]interface{}) (ModernistRecipe, []string, error) {
+	recipe := ModernistRecipe{
+		Title:    schemaOrgText(object["name"]),
+		Portions: schemaOrgText(object["recipeYield"]),
+		Source:   schemaOrgText(object["url"]),
+		Tags:     schemaOrgKeywords(object["keywords"]),
+	}
+	if recipe.Title == "" {
+		return recipe, nil, fmt.Errorf("%w: recipe without a name", ErrNoRecipeFound)
+	}
+
+	var losses []string
+	for _, field := range []struct {
+		key    string
+		target *Duration
+	}{
+		{"prepTime", &recipe.PreparationTime},
+		{"cookTime", &recipe.CookingTime},
+		{"totalTime", &recipe.TotalTime},
+	} {
+		if value := schemaOrgText(object[field.key]); value != "" {
+			duration, err := parseIsoDuration(value)
+			if err != nil {
+				losses = append(losses, fmt.Sprintf("%s: dropping '%s'", field.key, value))
+				continue
+			}
+			*field.target = duration
+		}
+	}
+
+	recipe.Steps = schemaOrgSteps(object["recipeInstructions"])
+	if len(recipe.Steps) == 0 {
+		recipe.Steps = []Step{{}}
+	}
+	ingredients, _ := object["recipeIngredient"].([]interface{})
+	if ingredients == nil {
+		// Older versions of schema.org
+		ingredients, _ = object["ingredients"].([]interface{})
+	}
+	for _, ingredient := range ingredients {
+		if text := schemaOrgText(ingredient); text != "" {
+			recipe.Steps[0].Ingredients = append(recipe.Steps[0].Ingredients, ParseIngredient(text))
+		}
+	}
+	return recipe, losses, nil
+}
+
+// schemaOrgText converts a JSON-LD value to plain text.  Of lists the first
+// element is used.
+func schemaOrgText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		text := htmlTagRegexp.ReplaceAllString(htmlBreakRegexp.ReplaceAllString(v, " "), "")
+		text = html.UnescapeString(text)
+		return strings.Join(strings.Fields(text), " ")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		if len(v) > 0 {
+			return schemaOrgText(v[0])
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"text", "name", "@id"} {
+			if text := schemaOrgText(v[key]); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// schemaOrgKeywords splits the keywords, which are either a list or a
+// comma separated string, into tags.
+func schemaOrgKeywords(value interface{}) []string {
+	var tags []string
+	switch v := value.(type) {
+	case string:
+		tags = parseTags(schemaOrgText(v))
+	case []interface{}:
+		for _, item := range v {
+			tags = append(tags, parseTags(schemaOrgText(item))...)
+		}
+	}
+	return tags
+}
+
+// schemaOrgSteps converts the instructions.  Every HowToSection becomes a step
+// of its own, consecutive HowToSteps are combined into a single step with one
+// paragraph each.
+func schemaOrgSteps(value interface{}) []Step {
+	var steps []Step
+	var paragraphs []string
+	flush := func() {
+		if len(paragraphs) > 0 {
+			steps = append(steps, Step{Instructions: strings.Join(paragraphs, "\n\n")})
+			paragraphs = nil
+		}
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+	for _, item := range items {
+		object, ok := item.(map[string]interface{})
+		if ok && hasSchemaOrgType(object, "HowToSection") {
+			flush()
+			step := Step{Instructions: strings.Join(schemaOrgParagraphs(object["itemListElement"]), "\n\n")}
+			if title := schemaOrgText(object["name"]); title != "" {
+				step.Title = &title
+			}
+			steps = append(steps, step)
+			continue
+		}
+		paragraphs = append(paragraphs, schemaOrgParagraphs(item)...)
+	}
+	flush()
+	return steps
+}
+
+// schemaOrgParagraphs collects the texts of HowToSteps and similar objects.
+func schemaOrgParagraphs(value interface{}) []string {
+	switch v := value.(type) {
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			result = append(result, schemaOrgParagraphs(item)...)
+		}
+		return result
+	case map[string]interface{}:
+		if text := schemaOrgText(v["text"]); text != "" {
+			return []string{text}
+		}
+		return schemaOrgParagraphs(v["itemListElement"])
+	case string:
+		if text := schemaOrgText(v); text != "" {
+			return []string{text}
+		}
+	}
+	return nil
+}
+
+// parseIsoDuration parses durations such as "PT1H30M" as used by schema.org.
+func parseIsoDuration(s string) (Duration, error) {
+	match := isoDurationRegexp.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if match == nil {
+		return 0, fmt.Errorf("invalid ISO 8601 duration '%s'", s)
+	}
+	var result time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if match[i+1] != "" {
+			x, _ := strconv.ParseFloat(match[i+1], 64)
+			result += time.Duration(x * float64(unit))
+		}
+	}
+	return Duration(result), nil
+}
+
+// SchemaOrgRecipe is a schema.org Recipe as used in JSON-LD.
+type SchemaOrgRecipe struct {
+	Context      string          `json:"@context"`
+	Type         string          `json:"@type"`
+	Name         string          `json:"name"`
+	Url          string          `json:"url,omitempty"`
+	Author       *SchemaOrgThing `json:"author,omitempty"`
+	Yield        string          `json:"recipeYield,omitempty"`
+	Keywords     string          `json:"keywords,omitempty"`
+	PrepTime     string          `json:"prepTime,omitempty"`
+	CookTime     string          `json:"cookTime,omitempty"`
+	TotalTime    string          `json:"totalTime,omitempty"`
+	Ingredients  []string        `json:"recipeIngredient"`
+	Instructions []interface{}   `json:"recipeInstructions"`
+}
+
+// SchemaOrgThing is used for the parts of a schema.org Recipe, such as
+// HowToSection, HowToStep or Person.
+type SchemaOrgThing struct {
+	Type  string           `json:"@type"`
+	Name  string           `json:"name,omitempty"`
+	Text  string           `json:"text,omitempty"`
+	Items []SchemaOrgThing `json:"itemListElement,omitempty"`
+}
+
+// ToSchemaOrg describes a recipe using schema.org.  Titled steps become
+// HowToSections, every paragraph of the instructions a HowToStep.  A source
+// that is not a URL is taken to be the author.
+func ToSchemaOrg(recipe ModernistRecipe) SchemaOrgRecipe {
+	result := SchemaOrgRecipe{
+		Context:      "https://schema.org",
+		Type:         "Recipe",
+		Name:         recipe.Title,
+		Yield:        recipe.Portions,
+		Keywords:     strings.Join(recipe.Tags, ", "),
+		PrepTime:     isoDuration(recipe.PreparationTime),
+		CookTime:     isoDuration(recipe.CookingTime + recipe.BakingTime),
+		TotalTime:    isoDuration(recipe.Duration()),
+		Ingredients:  []string{},
+		Instructions: []interface{}{},
+	}
+	if strings.HasPrefix(recipe.Source, "http://") || strings.HasPrefix(recipe.Source, "https://") {
+		result.Url = recipe.Source
+	} else if recipe.Source != "" {
+		result.Author = &SchemaOrgThing{Type: "Person", Name: recipe.Source}
+	}
+
+	for _, step := range recipe.Steps {
+		for _, ingredient := range step.Ingredients {
+			result.Ingredients = append(result.Ingredients, ingredient.String())
+		}
+
+		var howToSteps []SchemaOrgThing
+		for _, paragraph := range paragraphBreakRegexp.Split(strings.TrimSpace(step.Instructions), -1) {
+			if paragraph != "" {
+				howToSteps = append(howToSteps, SchemaOrgThing{Type: "HowToStep", Text: paragraph})
+			}
+		}
+		if step.Title != nil {
+			result.Instructions = append(result.Instructions,
+				SchemaOrgThing{Type: "HowToSection", Name: *step.Title, Items: howToSteps})
+			continue
+		}
+		for _, howToStep := range howToSteps {
+			result.Instructions = append(result.Instructions, howToStep)
+		}
+	}
+	return result
+}
+
+// isoDuration formats a duration as used by schema.org, e.g. "PT1H30M".
+func isoDuration(d Duration) string {
+	if d == 0 {
+		return ""
+	}
+	minutes := int(math.Round(d.Minutes()))
+	result := "PT"
+	if minutes >= 60 {
+		result += strconv.Itoa(minutes/60) + "H"
+	}
+	if minutes%60 != 0 || minutes < 60 {
+		result += strconv.Itoa(minutes%60) + "M"
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package apsa
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func jsonLdPage(jsonLd string) []byte {
+	return []byte(`<html><head><script type="application/ld+json">` + jsonLd + `</script></head></html>`)
+}
+
+func TestImportSchemaOrg(t *testing.T) {
+	tests := []struct {
+		name         string
+		page         []byte
+		title        string
+		tags         int
+		steps        int
+		ingredients  int
+		totalTime    time.Duration
+		losses       int
+		instructions string
+	}{
+		{
+			name: "plain",
+			page: jsonLdPage(`{"@context": "https://schema.org", "@type": "Recipe", "name": "Waffeln",
+				"recipeYield": ["4", "4 Portionen"], "keywords": "schnell, süß",
+				"totalTime": "PT1H30M", "recipeIngredient": ["250g Mehl", "3 Eier"],
+				"recipeInstructions": [{"@type": "HowToStep", "text": "Verrühren."},
+					{"@type": "HowToStep", "text": "Backen."}]}`),
+			title: "Waffeln", tags: 2, steps: 1, ingredients: 2, totalTime: 90 * time.Minute,
+			instructions: "Verrühren.\n\nBacken.",
+		},
+		{
+			name: "graph",
+			page: jsonLdPage(`{"@graph": [{"@type": "WebPage"}, {"@type": ["Recipe"], "name": "Brot",
+				"recipeInstructions": "Kneten<br>und backen."}]}`),
+			title: "Brot", steps: 1, instructions: "Kneten und backen.",
+		},
+		{
+			name: "sections",
+			page: jsonLdPage(`{"@type": "Recipe", "name": "Kuchen", "ingredients": ["200g Mehl"],
+				"recipeInstructions": [{"@type": "HowToSection", "name": "Teig",
+					"itemListElement": [{"@type": "HowToStep", "text": "Kneten."}]},
+				{"@type": "HowToSection", "name": "Guss", "itemListElement": ["Rühren."]}]}`),
+			title: "Kuchen", steps: 2, ingredients: 1, instructions: "Kneten.",
+		},
+		{
+			name: "invalid duration",
+			page: jsonLdPage(`{"@type": "Recipe", "name": "Suppe", "prepTime": "10 Minuten",
+				"cookTime": "PT20M", "totalTime": "PT30M", "recipeInstructions": "Kochen."}`),
+			title: "Suppe", steps: 1, totalTime: 30 * time.Minute, losses: 1, instructions: "Kochen.",
+		},
+		{
+			name:  "broken JSON first",
+			page:  append(jsonLdPage(`{"@type": `), jsonLdPage(`{"@type": "Recipe", "name": "Salat"}`)...),
+			title: "Salat", steps: 1,
+		},
+	}
+	for _, test := range tests {
+		recipe, losses, err := ImportSchemaOrg(test.page)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(losses) != test.losses {
+			t.Errorf("%s: got losses %v, want %d", test.name, losses, test.losses)
+		}
+		if recipe.Title != test.title || len(recipe.Tags) != test.tags || len(recipe.Steps) != test.steps {
+			t.Errorf("%s: got title %q, tags %v and %d steps", test.name, recipe.Title, recipe.Tags, len(recipe.Steps))
+			continue
+		}
+		if len(recipe.Steps[0].Ingredients) != test.ingredients {
+			t.Errorf("%s: got ingredients %v", test.name, recipe.Steps[0].Ingredients)
+		}
+		if recipe.Steps[0].Instructions != test.instructions {
+			t.Errorf("%s: got instructions %q, want %q", test.name, recipe.Steps[0].Instructions, test.instructions)
+		}
+		if time.Duration(recipe.TotalTime) != test.totalTime {
+			t.Errorf("%s: got total time %v, want %v", test.name, time.Duration(recipe.TotalTime), test.totalTime)
+		}
+	}
+
+	for _, p := range [][]byte{
+		[]byte("<html></html>"),
+		jsonLdPage(`{"@type": "Article", "name": "Kein Rezept"}`),
+		jsonLdPage(`{"@type": "Recipe"}`),
+	} {
+		if _, _, err := ImportSchemaOrg(p); !errors.Is(err, ErrNoRecipeFound) {
+			t.Errorf("ImportSchemaOrg(%q) returned %v, want ErrNoRecipeFound", p, err)
+		}
+	}
+}
+
+func TestParseIsoDuration(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+	}{
+		{"PT20M", 20 * time.Minute},
+		{"PT1H30M", 90 * time.Minute},
+		{"P1DT2H", 26 * time.Hour},
+		{"pt45s", 45 * time.Second},
+		{"PT1.5H", 90 * time.Minute},
+	}
+	for _, test := range tests {
+		got, err := parseIsoDuration(test.text)
+		if err != nil || time.Duration(got) != test.want {
+			t.Errorf("parseIsoDuration(%q) = %v, %v, want %v", test.text, time.Duration(got), err, test.want)
+		}
+	}
+	for _, text := range []string{"", "20 Minuten", "1H", "PT1Std"} {
+		if _, err := parseIsoDuration(text); err == nil {
+			t.Errorf("parseIsoDuration(%q) should fail", text)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package apsa
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+	"gopkg.in/yaml.v2"
+
+	"github.com/yzhs/apsa/units"
+)
+
+// defaultCategories is used unless ~/.apsa/categories.yaml exists.
+//
+//go:embed categories.yaml
+var defaultCategories []byte
+
+// otherCategory contains all ingredients not found in any category.
+const otherCategory = "Sonstiges"
+
+// Categories maps ingredients to the section of the store they can be found
+// in.  The categories are ordered the way one walks through the store.
+type Categories []Category
+
+type Category struct {
+	Name        string
+	Ingredients []string
+}
+
+// ReadCategories reads the categories from ~/.apsa/categories.yaml, falling
+// back to a built-in list if that file does not exist.
+func ReadCategories() (Categories, error) {
+	filename := Config.ApsaDirectory + "categories.yaml"
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		filename, content = "categories.yaml", defaultCategories
+	} else if err != nil {
+		return nil, err
+	}
+	categories, err := ParseCategories(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return categories, nil
+}
+
+// ParseCategories parses a YAML mapping of category names to lists of
+// ingredients, keeping the categories in order.
+func ParseCategories(content []byte) (Categories, error) {
+	var mapping yaml.MapSlice
+	if err := yaml.Unmarshal(content, &mapping); err != nil {
+		return nil, err
+	}
+	var categories Categories
+	for _, item := range mapping {
+		category := Category{Name: fmt.Sprint(item.Key)}
+		ingredients, ok := item.Value.([]interface{})
+		if !ok && item.Value != nil {
+			return nil, fmt.Errorf("category %s is not a list of ingredients", category.Name)
+		}
+		for _, ingredient := range ingredients {
+			category.Ingredients = append(category.Ingredients, fmt.Sprint(ingredient))
+		}
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
+
+// Find returns the category of an ingredient, or "Sonstiges" if it belongs to
+// none of them.  The longest matching entry wins, so "Puderzucker" is not
+// taken for "Zucker".
+func (c Categories) Find(name string) string {
+	name = ingredientKey(name)
+	result, longest := otherCategory, 0
+	for _, category := range c {
+		for _, ingredient := range category.Ingredients {
+			entry := ingredientKey(ingredient)
+			n := utf8.RuneCountInString(entry)
+			if n > longest && ingredientMatches(name, entry) {
+				result, longest = category.Name, n
+			}
+		}
+	}
+	return result
+}
+
+// ingredientMatches reports whether name contains entry as a word or, for
+// entries of at least three letters, ends with it, as in "Weizenmehl".  Both
+// have to be normalised using ingredientKey.
+func ingredientMatches(name, entry string) bool {
+	if findWord(name, entry) >= 0 {
+		return true
+	}
+	return utf8.RuneCountInString(entry) >= 3 && strings.HasSuffix(name, entry)
+}
+
+// ingredientKey normalises the name of an ingredient such that different
+// spellings of the same ingredient can be found.
+func ingredientKey(name string) string {
+	return strings.ToLower(norm.NFC.String(strings.Join(strings.Fields(name), " ")))
+}
+
+// Quantity is an amount of something in a certain unit.
+type Quantity struct {
+	Amount Amount `json:"amount"`
+	Unit   string `json:"unit"`
+}
+
+func (q Quantity) String() string {
+	return Ingredient{Amount: q.Amount, Unit: q.Unit}.Quantity()
+}
+
+// add sums up two quantities if their units are compatible.
+func (q Quantity) add(other Quantity) (Quantity, bool) {
+	if q.Unit == other.Unit {
+		return Quantity{Amount{q.Amount.Min + other.Amount.Min, q.Amount.Max + other.Amount.Max}, q.Unit}, true
+	}
+	if !units.Compatible(q.Unit, other.Unit) {
+		return q, false
+	}
+	base, _ := units.Base(q.Unit)
+	a, _ := units.Convert(1, q.Unit, base)
+	b, _ := units.Convert(1, other.Unit, base)
+	return Quantity{Amount{
+		q.Amount.Min*a + other.Amount.Min*b,
+		q.Amount.Max*a + other.Amount.Max*b,
+	}, base}, true
+}
+
+// convertUnits expresses the quantity in units of the given system.
+func (q Quantity) convertUnits(system units.System) Quantity {
+	ingredient := Ingredient{Amount: q.Amount, Unit: q.Unit}.ConvertUnits(system, 0)
+	return Quantity{ingredient.Amount, ingredient.Unit}
+}
+
+// simplify expresses a quantity in the largest unit that makes sense, e.g.
+// 1500g as 1,5kg or 6 TL as 2 EL, as long as no precision is lost.
+func (q Quantity) simplify() Quantity {
+	scale := func(factor float64, unit string) Quantity {
+		return Quantity{Amount{q.Amount.Min / factor, q.Amount.Max / factor}, unit}
+	}
+	// Amounts are shown with at most two decimal places, so 1125g stays
+	// as it is.
+	exact := func(factor float64) bool {
+		return isWhole(q.Amount.Min/factor*100) && isWhole(q.Amount.Max/factor*100)
+	}
+	switch q.Unit {
+	case "g":
+		if q.Amount.Min >= 1000 && exact(1000) {
+			return scale(1000, "kg")
+		}
+	case "ml":
+		if q.Amount.Min >= 1000 && exact(1000) {
+			return scale(1000, "l")
+		}
+	case "TL":
+		if isWhole(q.Amount.Min/3) && isWhole(q.Amount.Max/3) {
+			return scale(3, "EL")
+		}
+	}
+	return q
+}
+
+// isWhole reports whether x is an integer, ignoring rounding errors.
+func isWhole(x float64) bool {
+	return math.Abs(x-math.Round(x)) < 1e-9
+}
+
+// ShoppingListEntry is a recipe to buy ingredients for.  If Portions is zero,
+// the recipe is used as written.
+type ShoppingListEntry struct {
+	Id       Id
+	Portions float64
+}
+
+// ParseShoppingListEntry parses a recipe id, optionally followed by a colon
+// and the number of portions, as in "stollen:12".
+func ParseShoppingListEntry(s string) (ShoppingListEntry, error) {
+	id, portions, ok := strings.Cut(s, ":")
+	entry := ShoppingListEntry{Id: Id(id)}
+	if ok {
+		var err error
+		entry.Portions, err = strconv.ParseFloat(strings.Replace(portions, ",", ".", 1), 64)
+		if err != nil || entry.Portions <= 0 {
+			return entry, fmt.Errorf("invalid number of portions: '%s'", portions)
+		}
+	}
+	return entry, checkId(entry.Id)
+}
+
+// ShoppingList contains the ingredients of several recipes grouped by the
+// section of the store they are found in.
+type ShoppingList struct {
+	Recipes  []ModernistRecipe `json:"recipes"`
+	Sections []ShoppingSection `json:"sections"`
+}
+
+type ShoppingSection struct {
+	Category string         `json:"category"`
+	Items    []ShoppingItem `json:"items"`
+}
+
+// ShoppingItem is an ingredient needed by one or more recipes.  Amounts in
+// units that cannot be converted into each other, like "2 EL" and "100g",
+// are listed separately.
+type ShoppingItem struct {
+	Name       string     `json:"name"`
+	Quantities []Quantity `json:"quantities"`
+
+	// Recipes lists the titles of the recipes using the ingredient.
+	Recipes []string `json:"recipes"`
+}
+
+func (i ShoppingItem) String() string {
+	if len(i.Quantities) == 0 {
+		return i.Name
+	}
+	quantities := make([]string, len(i.Quantities))
+	for j, quantity := range i.Quantities {
+		quantities[j] = quantity.String()
+	}
+	return strings.Join(quantities, " + ") + " " + i.Name
+}
+
+// NewShoppingList reads the given recipes, scales them and merges their
+// ingredients.
+func NewShoppingList(backend Backend, entries []ShoppingListEntry, categories Categories) (ShoppingList, error) {
+	recipes := make([]ModernistRecipe, 0, len(entries))
+	for _, entry := range entries {
+		recipe, err := backend.ReadRecipe(entry.Id)
+		if err != nil {
+			return ShoppingList{}, err
+		}
+		if entry.Portions != 0 {
+			recipe, err = ScaleToPortions(recipe, entry.Portions)
+			if err != nil {
+				return ShoppingList{}, err
+			}
+		}
+		recipes = append(recipes, recipe)
+	}
+	return MakeShoppingList(recipes, categories), nil
+}
+
+// MakeShoppingList merges the ingredients of all steps of the given recipes
+// and groups them by category.
+func MakeShoppingList(recipes []ModernistRecipe, categories Categories) ShoppingList {
+	sections := make(map[string][]ShoppingItem)
+	for _, item := range mergeIngredients(recipes) {
+		category := categories.Find(item.Name)
+		sections[category] = append(sections[category], item)
+	}
+
+	collator := newCollator()
+	result := ShoppingList{Recipes: recipes}
+	for _, category := range append(categories, Category{Name: otherCategory}) {
+		items, ok := sections[category.Name]
+		if !ok {
+			continue
+		}
+		delete(sections, category.Name)
+		sort.SliceStable(items, func(i, j int) bool {
+			return collator.CompareString(items[i].Name, items[j].Name) < 0
+		})
+		result.Sections = append(result.Sections, ShoppingSection{category.Name, items})
+	}
+	return result
+}
+
+// ConvertUnits expresses all amounts in the shopping list in units of the
+// given system.
+func (l ShoppingList) ConvertUnits(system units.System) ShoppingList {
+	if system == units.Original {
+		return l
+	}
+	result := ShoppingList{Recipes: make([]ModernistRecipe, len(l.Recipes))}
+	for i, recipe := range l.Recipes {
+		result.Recipes[i] = ConvertUnits(recipe, system, nil)
+	}
+	for _, section := range l.Sections {
+		items := make([]ShoppingItem, len(section.Items))
+		for i, item := range section.Items {
+			items[i] = item
+			items[i].Quantities = make([]Quantity, len(item.Quantities))
+			for j, quantity := range item.Quantities {
+				items[i].Quantities[j] = quantity.convertUnits(system)
+			}
+		}
+		result.Sections = append(result.Sections, ShoppingSection{section.Category, items})
+	}
+	return result
+}
+
+// preparationWords are adjectives and participles describing how an
+// ingredient is prepared rather than what to buy, as in "zerlassene Butter".
+var preparationWords = map[string]bool{
+	"lauwarm": true, "warm": true, "kalt": true, "eiskalt": true, "heiß": true,
+	"kochend": true, "zimmerwarm": true, "weich": true, "flüssig": true,
+	"zerlassen": true, "geschmolzen": true, "gehackt": true, "gemahlen": true,
+	"gerieben": true, "gewürfelt": true, "geschält": true, "gesiebt": true,
+	"verquirlt": true, "geschlagen": true,
+}
+
+// adjectiveEndings are the endings of declined German adjectives, longest
+// first.
+var adjectiveEndings = []string{"en", "em", "er", "es", "e"}
+
+// shoppingName drops the words describing the preparation from the start of
+// the name of an ingredient, so that "lauwarme Milch" and "Milch" end up on
+// the shopping list together.
+func shoppingName(name string) string {
+	words := strings.Fields(name)
+	for len(words) > 1 && isPreparationWord(words[0]) {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+func isPreparationWord(word string) bool {
+	word = strings.ToLower(strings.Trim(word, ","))
+	if preparationWords[word] {
+		return true
+	}
+	for _, ending := range adjectiveEndings {
+		if stem, ok := strings.CutSuffix(word, ending); ok && preparationWords[stem] {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeIngredients combines ingredients with the same name, adding up their
+// amounts where the units allow it.  Words describing the preparation are
+// ignored.  The items are in the order in which the ingredients first occur.
+func mergeIngredients(recipes []ModernistRecipe) []ShoppingItem {
+	items := make(map[string]*ShoppingItem)
+	var order []string
+	for _, recipe := range recipes {
+		for _, step := range recipe.Steps {
+			for _, ingredient := range step.Ingredients {
+				name := shoppingName(ingredient.Name)
+				if name == "" {
+					name = ingredient.String()
+				}
+				key := ingredientKey(name)
+				if key == "" {
+					continue
+				}
+				item, ok := items[key]
+				if !ok {
+					item = &ShoppingItem{Name: name}
+					items[key] = item
+					order = append(order, key)
+				}
+				if n := len(item.Recipes); n == 0 || item.Recipes[n-1] != recipe.Title {
+					item.Recipes = append(item.Recipes, recipe.Title)
+				}
+				if !ingredient.Amount.IsZero() {
+					item.addQuantity(Quantity{ingredient.Amount, ingredient.Unit})
+				}
+			}
+		}
+	}
+
+	result := make([]ShoppingItem, len(order))
+	for i, key := range order {
+		item := items[key]
+		for j, quantity := range item.Quantities {
+			item.Quantities[j] = quantity.simplify()
+		}
+		result[i] = *item
+	}
+	return result
+}
+
+// addQuantity adds to the first quantity with a compatible unit, or appends
+// the quantity if there is none.
+func (i *ShoppingItem) addQuantity(quantity Quantity) {
+	for j, existing := range i.Quantities {
+		if sum, ok := existing.add(quantity); ok {
+			i.Quantities[j] = sum
+			return
+		}
+	}
+	i.Quantities = append(i.Quantities, quantity)
+}
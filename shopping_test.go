@@ -0,0 +1,71 @@
+package apsa
+
+import "testing"
+
+func TestMergeIngredients(t *testing.T) {
+	tests := []struct {
+		name    string
+		recipes []ModernistRecipe
+		want    []string
+	}{
+		{
+			"same name",
+			[]ModernistRecipe{testRecipe("A", "200g Mehl", "1 Prise Salz"), testRecipe("B", "1 kg mehl")},
+			[]string{"1,2kg Mehl", "1 Prise Salz"},
+		},
+		{
+			"preparation",
+			[]ModernistRecipe{testRecipe("A", "50g zerlassene Butter"), testRecipe("B", "100g Butter")},
+			[]string{"150g Butter"},
+		},
+		{
+			"temperature",
+			[]ModernistRecipe{testRecipe("A", "200ml lauwarme Milch"), testRecipe("B", "0,5 l kalte Milch", "Milch")},
+			[]string{"700ml Milch"},
+		},
+		{
+			"participle",
+			[]ModernistRecipe{testRecipe("A", "100g gemahlene Mandeln", "50g gehackte Mandeln")},
+			[]string{"150g Mandeln"},
+		},
+		{
+			"variety",
+			[]ModernistRecipe{testRecipe("A", "100g weiße Schokolade", "100g Schokolade", "2 rote Zwiebeln")},
+			[]string{"100g weiße Schokolade", "100g Schokolade", "2 rote Zwiebeln"},
+		},
+		{
+			"incompatible units",
+			[]ModernistRecipe{testRecipe("A", "1 EL weiche Butter", "100g Butter")},
+			[]string{"1 EL + 100g Butter"},
+		},
+	}
+	for _, test := range tests {
+		items := mergeIngredients(test.recipes)
+		if len(items) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, items, test.want)
+			continue
+		}
+		for i, item := range items {
+			if item.String() != test.want[i] {
+				t.Errorf("%s: item %d is %q, want %q", test.name, i, item, test.want[i])
+			}
+		}
+	}
+}
+
+func TestShoppingName(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"zerlassene Butter", "Butter"},
+		{"lauwarme Milch", "Milch"},
+		{"Eier, verquirlt", "Eier, verquirlt"},
+		{"kalte, weiche Butter", "Butter"},
+		{"heißes Wasser", "Wasser"},
+		{"warm", "warm"},
+		{"rote Zwiebeln", "rote Zwiebeln"},
+	}
+	for _, test := range tests {
+		if got := shoppingName(test.name); got != test.want {
+			t.Errorf("shoppingName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
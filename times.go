@@ -0,0 +1,230 @@
+package apsa
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/yzhs/apsa/units"
+)
+
+// Duration is the time a part of a recipe takes.
+type Duration time.Duration
+
+var durationUnits = map[string]time.Duration{
+	"s": time.Second, "sek": time.Second, "sek.": time.Second,
+	"sekunde": time.Second, "sekunden": time.Second,
+	"m": time.Minute, "min": time.Minute, "min.": time.Minute,
+	"minute": time.Minute, "minuten": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "std": time.Hour, "std.": time.Hour,
+	"stunde": time.Hour, "stunden": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "tag": 24 * time.Hour, "tage": 24 * time.Hour, "days": 24 * time.Hour,
+}
+
+var durationRegexp = regexp.MustCompile(
+	`(\d+(?:[.,]\d+)?)(?:\s*(?:-|–|bis)\s*(\d+(?:[.,]\d+)?))?\s*([[:alpha:]]+\.?)?`)
+
+// ParseDuration parses durations such as "30 Minuten", "1 Std. 30 Min." or
+// "1h30m".  Of ranges such as "60 bis 70 Minuten" the upper bound is used.  A
+// plain number is taken to be minutes.
+func ParseDuration(s string) (Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	var result time.Duration
+	matches := durationRegexp.FindAllStringSubmatch(s, -1)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+	for _, match := range matches {
+		value := match[1]
+		if match[2] != "" {
+			value = match[2]
+		}
+		x, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+
+		unit := time.Minute
+		if match[3] != "" {
+			var ok bool
+			unit, ok = durationUnits[strings.ToLower(match[3])]
+			if !ok {
+				return 0, fmt.Errorf("invalid duration '%s': unknown unit '%s'", s, match[3])
+			}
+		}
+		result += time.Duration(x * float64(unit))
+	}
+	return Duration(result), nil
+}
+
+// Minutes returns the duration as a floating point number of minutes.
+func (d Duration) Minutes() float64 {
+	return time.Duration(d).Minutes()
+}
+
+// String formats the duration rounded to whole minutes, e.g. "1 Std. 30 Min.".
+// Durations under half a minute are given in seconds instead, so that they
+// are not lost when writing a recipe.
+func (d Duration) String() string {
+	if d == 0 {
+		return ""
+	}
+	minutes := int(math.Round(d.Minutes()))
+	if minutes == 0 {
+		return fmt.Sprintf("%d Sek.", max(1, int(math.Round(time.Duration(d).Seconds()))))
+	}
+	var parts []string
+	if minutes >= 60 {
+		parts = append(parts, fmt.Sprintf("%d Std.", minutes/60))
+	}
+	if minutes%60 != 0 {
+		parts = append(parts, fmt.Sprintf("%d Min.", minutes%60))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Minutes())
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+	duration, err := ParseDuration(text)
+	if err != nil {
+		return &yaml.TypeError{Errors: []string{err.Error()}}
+	}
+	*d = duration
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// HeatingMode describes how an oven is heated.
+type HeatingMode int
+
+const (
+	UnknownHeating HeatingMode = iota
+	FanHeating
+	TopAndBottomHeating
+)
+
+func (m HeatingMode) String() string {
+	switch m {
+	case FanHeating:
+		return "Umluft"
+	case TopAndBottomHeating:
+		return "Ober- und Unterhitze"
+	default:
+		return ""
+	}
+}
+
+func (m HeatingMode) MarshalText() ([]byte, error) {
+	switch m {
+	case FanHeating:
+		return []byte("fan"), nil
+	case TopAndBottomHeating:
+		return []byte("top_and_bottom"), nil
+	default:
+		return []byte(""), nil
+	}
+}
+
+// Temperature is an oven temperature.
+type Temperature struct {
+	Degrees float64 `json:"degrees"`
+
+	// Unit is either "°C" or "°F".
+	Unit string `json:"unit"`
+
+	Mode HeatingMode `json:"mode"`
+}
+
+var temperatureRegexp = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)(?:\s*(?:-|–|bis)\s*\d+(?:[.,]\d+)?)?\s*(°\s*[CF]|Grad|[CF]\b)?`)
+
+// ParseTemperature parses temperatures such as "175°C" or "350 °F".  Plain
+// numbers are taken to be degrees Celsius.  The heating mode is taken from the
+// text if it mentions one, otherwise mode is used.
+func ParseTemperature(s string, mode HeatingMode) (*Temperature, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	match := temperatureRegexp.FindStringSubmatch(s)
+	if match == nil {
+		return nil, fmt.Errorf("invalid temperature '%s'", s)
+	}
+	degrees, err := strconv.ParseFloat(strings.Replace(match[1], ",", ".", 1), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid temperature '%s'", s)
+	}
+
+	unit := "°C"
+	if strings.HasSuffix(match[2], "F") {
+		unit = "°F"
+	}
+
+	rest := strings.ToLower(s[len(match[0]):])
+	switch {
+	case strings.Contains(rest, "umluft"):
+		mode = FanHeating
+	case strings.Contains(rest, "ober"):
+		mode = TopAndBottomHeating
+	}
+
+	return &Temperature{Degrees: degrees, Unit: unit, Mode: mode}, nil
+}
+
+func (t Temperature) String() string {
+	result := formatNumber(t.Degrees) + " " + t.Unit
+	if t.Mode != UnknownHeating {
+		result += " " + t.Mode.String()
+	}
+	return result
+}
+
+// convertUnits returns the temperature in degrees of the given system.
+func (t *Temperature) convertUnits(system units.System) *Temperature {
+	if t == nil {
+		return nil
+	}
+	result := *t
+	result.Degrees, result.Unit = system.Temperature(t.Degrees, t.Unit)
+	return &result
+}
+
+func (t *Temperature) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+	temperature, err := ParseTemperature(text, UnknownHeating)
+	if err != nil {
+		return &yaml.TypeError{Errors: []string{err.Error()}}
+	}
+	if temperature != nil {
+		*t = *temperature
+	}
+	return nil
+}
+
+func (t Temperature) MarshalYAML() (interface{}, error) {
+	// The heating mode is implied by the field the temperature is stored in.
+	return formatNumber(t.Degrees) + t.Unit, nil
+}
@@ -0,0 +1,88 @@
+package apsa
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Minute},
+		{"70 Minuten", 70 * time.Minute},
+		{"1 Stunde", time.Hour},
+		{"1 Std. 10 Min.", 70 * time.Minute},
+		{"1,5 h", 90 * time.Minute},
+		{"2h 30m", 150 * time.Minute},
+		{"45 Sekunden", 45 * time.Second},
+	}
+	for _, test := range tests {
+		got, err := ParseDuration(test.text)
+		if err != nil {
+			t.Errorf("ParseDuration(%q): %v", test.text, err)
+		} else if time.Duration(got) != test.want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", test.text, time.Duration(got), test.want)
+		}
+	}
+
+	for _, text := range []string{"zwanzig Minuten", "10 Jahre", "lange"} {
+		if _, err := ParseDuration(text); err == nil {
+			t.Errorf("ParseDuration(%q) should fail", text)
+		}
+	}
+}
+
+func TestDurationString(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     string
+	}{
+		{0, ""},
+		{20 * time.Minute, "20 Min."},
+		{90 * time.Minute, "1 Std. 30 Min."},
+		{2 * time.Hour, "2 Std."},
+		{90 * time.Second, "2 Min."},
+		{20 * time.Second, "20 Sek."},
+		{time.Millisecond, "1 Sek."},
+	}
+	for _, test := range tests {
+		got := Duration(test.duration).String()
+		if got != test.want {
+			t.Errorf("Duration(%v).String() = %q, want %q", test.duration, got, test.want)
+		}
+		if parsed, err := ParseDuration(got); err != nil || test.duration != 0 && parsed == 0 {
+			t.Errorf("ParseDuration(%q) = %v, %v", got, time.Duration(parsed), err)
+		}
+	}
+}
+
+func TestParseTemperature(t *testing.T) {
+	tests := []struct {
+		text    string
+		degrees float64
+		unit    string
+		mode    HeatingMode
+	}{
+		{"175°C", 175, "°C", UnknownHeating},
+		{"180", 180, "°C", UnknownHeating},
+		{"350 °F", 350, "°F", UnknownHeating},
+		{"160 Grad Umluft", 160, "°C", FanHeating},
+		{"200°C Ober- und Unterhitze", 200, "°C", TopAndBottomHeating},
+		{"180-200°C", 180, "°C", UnknownHeating},
+	}
+	for _, test := range tests {
+		got, err := ParseTemperature(test.text, UnknownHeating)
+		if err != nil {
+			t.Errorf("ParseTemperature(%q): %v", test.text, err)
+		} else if got.Degrees != test.degrees || got.Unit != test.unit || got.Mode != test.mode {
+			t.Errorf("ParseTemperature(%q) = %+v", test.text, *got)
+		}
+	}
+
+	if _, err := ParseTemperature("heiß", UnknownHeating); err == nil {
+		t.Error("ParseTemperature(\"heiß\") should fail")
+	}
+}
@@ -0,0 +1,198 @@
+// Package units converts amounts of ingredients and oven temperatures between
+// units of measurement.
+package units
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// System is a system of units amounts are displayed in.
+type System int
+
+const (
+	// Original keeps the units the recipe was written in.
+	Original System = iota
+	Metric
+	Imperial
+)
+
+var systemNames = []string{"original", "metric", "imperial"}
+
+func (s System) String() string {
+	if s < 0 || int(s) >= len(systemNames) {
+		return ""
+	}
+	return systemNames[s]
+}
+
+// Set parses the name of a system, so a System can be used as a command line
+// flag.
+func (s *System) Set(name string) error {
+	for i, systemName := range systemNames {
+		if name == systemName {
+			*s = System(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown system of units '%s', expected one of %s",
+		name, strings.Join(systemNames, ", "))
+}
+
+// Dimension is what a unit measures.
+type Dimension int
+
+const (
+	// Other units, such as "Prise" or "Dose", cannot be converted.
+	Other Dimension = iota
+	Mass
+	Volume
+)
+
+// Unit is a unit of mass or volume.
+type Unit struct {
+	Name      string
+	Dimension Dimension
+	System    System
+
+	// Size in g or ml
+	Size float64
+
+	// Spoon is set for measuring spoons.  Adding "1 EL" to "100ml" makes
+	// little sense, so they are treated as a separate kind of volume.
+	Spoon bool
+}
+
+// knownUnits lists the canonical names of the units that can be converted.
+// American and German measuring spoons are taken to be the same size.
+var knownUnits = map[string]Unit{
+	"mg": {"mg", Mass, Metric, 0.001, false},
+	"g":  {"g", Mass, Metric, 1, false},
+	"kg": {"kg", Mass, Metric, 1000, false},
+	"oz": {"oz", Mass, Imperial, 28.35, false},
+	"lb": {"lb", Mass, Imperial, 453.6, false},
+
+	"ml":  {"ml", Volume, Metric, 1, false},
+	"cl":  {"cl", Volume, Metric, 10, false},
+	"dl":  {"dl", Volume, Metric, 100, false},
+	"l":   {"l", Volume, Metric, 1000, false},
+	"cup": {"cup", Volume, Imperial, 236.6, false},
+
+	"TL":   {"TL", Volume, Metric, 5, true},
+	"EL":   {"EL", Volume, Metric, 15, true},
+	"tsp":  {"tsp", Volume, Imperial, 5, true},
+	"tbsp": {"tbsp", Volume, Imperial, 15, true},
+}
+
+// Lookup finds a unit by its canonical name.
+func Lookup(name string) (Unit, bool) {
+	unit, ok := knownUnits[name]
+	return unit, ok
+}
+
+// Compatible reports whether amounts in the two units can be added up.
+func Compatible(a, b string) bool {
+	unitA, okA := knownUnits[a]
+	unitB, okB := knownUnits[b]
+	return okA && okB && unitA.Dimension == unitB.Dimension && unitA.Spoon == unitB.Spoon
+}
+
+// Base returns the smallest unit that amounts in the given unit can be added
+// up in, i.e. "g", "ml" or "TL".
+func Base(name string) (string, bool) {
+	unit, ok := knownUnits[name]
+	switch {
+	case !ok:
+		return name, false
+	case unit.Spoon:
+		return "TL", true
+	case unit.Dimension == Mass:
+		return "g", true
+	default:
+		return "ml", true
+	}
+}
+
+// Convert converts an amount between units of the same dimension.
+func Convert(amount float64, from, to string) (float64, bool) {
+	unitFrom, okFrom := knownUnits[from]
+	unitTo, okTo := knownUnits[to]
+	if !okFrom || !okTo || unitFrom.Dimension != unitTo.Dimension {
+		return amount, false
+	}
+	return amount * unitFrom.Size / unitTo.Size, true
+}
+
+// Grams converts an amount to grams, using the density in g/ml for volumes.
+// The second result is false if the unit is unknown or the density is needed
+// but zero.
+func Grams(amount float64, unit string, density float64) (float64, bool) {
+	u, ok := knownUnits[unit]
+	switch {
+	case !ok:
+		return 0, false
+	case u.Dimension == Mass:
+		return amount * u.Size, true
+	default:
+		return amount * u.Size * density, density != 0
+	}
+}
+
+// Convert expresses an amount in a unit of the system, choosing one that
+// keeps the number readable, e.g. 1500g as 3,3 lb rather than 52,9 oz.  Units
+// that already belong to the system are kept.
+func (s System) Convert(amount float64, unit string) (float64, string) {
+	u, ok := knownUnits[unit]
+	if !ok || s == Original || u.System == s {
+		return amount, unit
+	}
+
+	var target string
+	size := amount * u.Size
+	switch {
+	case u.Spoon && s == Metric:
+		target = strings.NewReplacer("tsp", "TL", "tbsp", "EL").Replace(unit)
+	case u.Spoon:
+		target = strings.NewReplacer("TL", "tsp", "EL", "tbsp").Replace(unit)
+	case u.Dimension == Mass && s == Metric:
+		target = pick(size, "kg", "g")
+	case u.Dimension == Mass:
+		target = pick(size, "lb", "oz")
+	case s == Metric:
+		target = pick(size, "l", "ml")
+	case size < knownUnits["tbsp"].Size:
+		target = "tsp"
+	case size < knownUnits["cup"].Size/4:
+		target = "tbsp"
+	default:
+		target = "cup"
+	}
+	result, _ := Convert(amount, unit, target)
+	return result, target
+}
+
+// pick returns large if size is at least one of it, and small otherwise.
+func pick(size float64, large, small string) string {
+	if size >= knownUnits[large].Size {
+		return large
+	}
+	return small
+}
+
+// Temperature converts an oven temperature given in "°C" or "°F" into the
+// system.  The result is rounded like the markings on an oven dial.
+func (s System) Temperature(degrees float64, unit string) (float64, string) {
+	switch {
+	case s == Metric && unit == "°F":
+		return roundTo((degrees-32)*5/9, 5), "°C"
+	case s == Imperial && unit == "°C":
+		return roundTo(degrees*9/5+32, 25), "°F"
+	default:
+		return degrees, unit
+	}
+}
+
+func roundTo(x, step float64) float64 {
+	return math.Round(x/step) * step
+}
@@ -0,0 +1,145 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		from, to string
+		want     float64
+		ok       bool
+	}{
+		{1.5, "kg", "g", 1500, true},
+		{250, "ml", "l", 0.25, true},
+		{1, "lb", "g", 453.6, true},
+		{2, "cup", "ml", 473.2, true},
+		{3, "TL", "EL", 1, true},
+		{1, "tbsp", "ml", 15, true},
+		{100, "g", "ml", 100, false},
+		{1, "Prise", "g", 1, false},
+	}
+	for _, test := range tests {
+		got, ok := Convert(test.amount, test.from, test.to)
+		if ok != test.ok || !near(got, test.want) {
+			t.Errorf("Convert(%v, %q, %q) = %v, %v, want %v, %v",
+				test.amount, test.from, test.to, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"g", "kg", true},
+		{"oz", "g", true},
+		{"ml", "cup", true},
+		{"TL", "tbsp", true},
+		{"EL", "ml", false},
+		{"g", "ml", false},
+		{"Prise", "Prise", false},
+	}
+	for _, test := range tests {
+		if got := Compatible(test.a, test.b); got != test.want {
+			t.Errorf("Compatible(%q, %q) = %v", test.a, test.b, got)
+		}
+	}
+}
+
+func TestGrams(t *testing.T) {
+	tests := []struct {
+		amount  float64
+		unit    string
+		density float64
+		want    float64
+		ok      bool
+	}{
+		{2, "kg", 0, 2000, true},
+		{1, "cup", 0.53, 125.4, true},
+		{1, "EL", 1, 15, true},
+		{1, "l", 0, 0, false},
+		{1, "Würfel", 1, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := Grams(test.amount, test.unit, test.density)
+		if ok != test.ok || ok && !near(got, test.want) {
+			t.Errorf("Grams(%v, %q, %v) = %v, %v, want %v, %v",
+				test.amount, test.unit, test.density, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestSystemConvert(t *testing.T) {
+	tests := []struct {
+		system   System
+		amount   float64
+		unit     string
+		want     float64
+		wantUnit string
+	}{
+		{Metric, 2, "lb", 907.2, "g"},
+		{Metric, 3, "lb", 1.361, "kg"},
+		{Metric, 4, "oz", 113.4, "g"},
+		{Metric, 1, "cup", 236.6, "ml"},
+		{Metric, 5, "cup", 1.183, "l"},
+		{Metric, 2, "tbsp", 2, "EL"},
+		{Metric, 200, "g", 200, "g"},
+		{Imperial, 1500, "g", 3.307, "lb"},
+		{Imperial, 100, "g", 3.527, "oz"},
+		{Imperial, 500, "ml", 2.113, "cup"},
+		{Imperial, 20, "ml", 1.333, "tbsp"},
+		{Imperial, 1, "TL", 1, "tsp"},
+		{Original, 1, "lb", 1, "lb"},
+		{Imperial, 1, "Prise", 1, "Prise"},
+	}
+	for _, test := range tests {
+		got, unit := test.system.Convert(test.amount, test.unit)
+		if unit != test.wantUnit || !near(got, test.want) {
+			t.Errorf("%v.Convert(%v, %q) = %v %s, want %v %s",
+				test.system, test.amount, test.unit, got, unit, test.want, test.wantUnit)
+		}
+	}
+}
+
+func TestSystemTemperature(t *testing.T) {
+	tests := []struct {
+		system   System
+		degrees  float64
+		unit     string
+		want     float64
+		wantUnit string
+	}{
+		{Metric, 350, "°F", 175, "°C"},
+		{Metric, 180, "°C", 180, "°C"},
+		{Imperial, 180, "°C", 350, "°F"},
+		{Imperial, 220, "°C", 425, "°F"},
+		{Original, 350, "°F", 350, "°F"},
+	}
+	for _, test := range tests {
+		got, unit := test.system.Temperature(test.degrees, test.unit)
+		if got != test.want || unit != test.wantUnit {
+			t.Errorf("%v.Temperature(%v, %q) = %v%s, want %v%s",
+				test.system, test.degrees, test.unit, got, unit, test.want, test.wantUnit)
+		}
+	}
+}
+
+func TestSystemSet(t *testing.T) {
+	var system System
+	for _, name := range []string{"metric", "imperial", "original"} {
+		if err := system.Set(name); err != nil || system.String() != name {
+			t.Errorf("Set(%q) = %v, yielding %v", name, err, system)
+		}
+	}
+	if err := system.Set("nautical"); err == nil {
+		t.Error("Set(\"nautical\") should fail")
+	}
+}